@@ -8,6 +8,10 @@ import (
 )
 
 type ChannelConfig struct {
+	// Name is an optional human-readable identifier of the configuration,
+	// used in logs to tell configurations apart.
+	Name string
+
 	// Number of epochs (L1 blocks) per sequencing window, including the epoch
 	// L1 origin block itself
 	SeqWindowSize uint64
@@ -82,6 +86,39 @@ func (cc *ChannelConfig) MaxFramesPerTx() int {
 	return cc.TargetNumFrames
 }
 
+// NumTxsFor estimates the number of L1 transactions needed to submit pendingBytes
+// of compressed channel data with this configuration. Each transaction carries
+// [ChannelConfig.MaxFramesPerTx] full frames, so for blob configurations frames are
+// grouped by TargetNumFrames, and for calldata configurations there is one frame per
+// transaction. The estimate assumes all frames are filled up to MaxFrameSize.
+func (cc *ChannelConfig) NumTxsFor(pendingBytes uint64) uint64 {
+	if pendingBytes == 0 {
+		return 0
+	}
+	txDataSize := cc.MaxDataPerTx()
+	return (pendingBytes + txDataSize - 1) / txDataSize
+}
+
+// MaxDataPerTx returns the number of channel data bytes a single L1 transaction can
+// carry with this configuration. This is TargetNumFrames full frames for blob
+// configurations, and a single full frame for calldata configurations, minus the
+// constant frame overhead of each frame.
+func (cc *ChannelConfig) MaxDataPerTx() uint64 {
+	return MaxDataSize(cc.MaxFramesPerTx(), cc.MaxFrameSize)
+}
+
+// Utilization returns the fraction of the capacity of the transactions needed to submit
+// pendingBytes of compressed channel data, see [ChannelConfig.NumTxsFor], that would be used.
+// A low utilization means that the last transaction would be mostly empty.
+// It returns 0 if there are no pending bytes.
+func (cc *ChannelConfig) Utilization(pendingBytes uint64) float64 {
+	numTxs := cc.NumTxsFor(pendingBytes)
+	if numTxs == 0 {
+		return 0
+	}
+	return float64(pendingBytes) / float64(numTxs*cc.MaxDataPerTx())
+}
+
 // Check validates the [ChannelConfig] parameters.
 func (cc *ChannelConfig) Check() error {
 	// The [ChannelTimeout] must be larger than the [SubSafetyMargin].
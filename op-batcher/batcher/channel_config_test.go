@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
 
 	"github.com/stretchr/testify/require"
 )
@@ -94,3 +95,77 @@ func FuzzChannelConfig_CheckTimeout(f *testing.F) {
 		require.ErrorIs(t, channelConfig.Check(), ErrInvalidChannelTimeout)
 	})
 }
+
+func TestChannelConfig_NumTxsFor(t *testing.T) {
+	calldataCfg := defaultTestChannelConfig()
+	blobCfg := defaultTestChannelConfig()
+	blobCfg.MaxFrameSize = eth.MaxBlobDataSize - 1
+	blobCfg.TargetNumFrames = 6
+	blobCfg.MultiFrameTxs = true
+
+	calldataTxSize := calldataCfg.MaxFrameSize - derive.FrameV0OverHeadSize
+	blobTxSize := 6 * (blobCfg.MaxFrameSize - derive.FrameV0OverHeadSize)
+
+	tests := []struct {
+		name         string
+		cfg          ChannelConfig
+		pendingBytes uint64
+		expTxs       uint64
+	}{
+		{name: "calldata-empty", cfg: calldataCfg, pendingBytes: 0, expTxs: 0},
+		{name: "calldata-one-byte", cfg: calldataCfg, pendingBytes: 1, expTxs: 1},
+		{name: "calldata-full", cfg: calldataCfg, pendingBytes: calldataTxSize, expTxs: 1},
+		{name: "calldata-overflow", cfg: calldataCfg, pendingBytes: calldataTxSize + 1, expTxs: 2},
+		{name: "calldata-many", cfg: calldataCfg, pendingBytes: 10 * calldataTxSize, expTxs: 10},
+		{name: "blobs-empty", cfg: blobCfg, pendingBytes: 0, expTxs: 0},
+		{name: "blobs-one-byte", cfg: blobCfg, pendingBytes: 1, expTxs: 1},
+		{name: "blobs-full", cfg: blobCfg, pendingBytes: blobTxSize, expTxs: 1},
+		{name: "blobs-overflow", cfg: blobCfg, pendingBytes: blobTxSize + 1, expTxs: 2},
+		{name: "blobs-many", cfg: blobCfg, pendingBytes: 10 * calldataTxSize, expTxs: 2},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expTxs, tt.cfg.NumTxsFor(tt.pendingBytes))
+		})
+	}
+}
+
+func TestChannelConfig_MaxDataPerTx(t *testing.T) {
+	calldataCfg := defaultTestChannelConfig()
+	require.Equal(t, calldataCfg.MaxFrameSize-derive.FrameV0OverHeadSize, calldataCfg.MaxDataPerTx())
+
+	blobCfg := defaultTestChannelConfig()
+	blobCfg.MaxFrameSize = eth.MaxBlobDataSize - 1
+	blobCfg.TargetNumFrames = 5
+	blobCfg.MultiFrameTxs = true
+	require.Equal(t, uint64(5*(eth.MaxBlobDataSize-1-derive.FrameV0OverHeadSize)), blobCfg.MaxDataPerTx())
+
+	// Without multi-frame txs, each frame is sent in its own tx.
+	blobCfg.MultiFrameTxs = false
+	require.Equal(t, blobCfg.MaxFrameSize-derive.FrameV0OverHeadSize, blobCfg.MaxDataPerTx())
+}
+
+func TestChannelConfig_Utilization(t *testing.T) {
+	cfg := defaultTestChannelConfig()
+	txSize := cfg.MaxDataPerTx()
+
+	tests := []struct {
+		name         string
+		pendingBytes uint64
+		exp          float64
+	}{
+		{name: "empty", pendingBytes: 0, exp: 0},
+		{name: "quarter", pendingBytes: txSize / 4, exp: float64(txSize/4) / float64(txSize)},
+		{name: "half", pendingBytes: txSize / 2, exp: float64(txSize/2) / float64(txSize)},
+		{name: "full", pendingBytes: txSize, exp: 1},
+		{name: "one-byte-over", pendingBytes: txSize + 1, exp: float64(txSize+1) / float64(2*txSize)},
+		{name: "three-full", pendingBytes: 3 * txSize, exp: 1},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require.InDelta(t, tt.exp, cfg.Utilization(tt.pendingBytes), 1e-9)
+		})
+	}
+}
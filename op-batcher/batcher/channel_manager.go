@@ -213,6 +213,7 @@ func (s *channelManager) ensureChannelWithSpace(l1Head eth.BlockID) error {
 
 	s.log.Info("Created channel",
 		"id", pc.ID(),
+		"channel_config", s.cfg.Name,
 		"l1Head", l1Head,
 		"l1OriginLastClosedChannel", s.l1OriginLastClosedChannel,
 		"blocks_pending", len(s.blocks),
@@ -483,3 +483,16 @@ func TestChannelManager_ChannelCreation(t *testing.T) {
 		})
 	}
 }
+
+func TestChannelManager_ChannelCreationLogsConfigName(t *testing.T) {
+	l, logs := testlog.CaptureLogger(t, log.LevelInfo)
+	cfg := channelManagerTestConfig(1000, derive.SpanBatchType)
+	cfg.Name = "test-blobs"
+	m := NewChannelManager(l, metrics.NoopMetrics, cfg, &defaultTestRollupConfig)
+
+	require.NoError(t, m.ensureChannelWithSpace(eth.BlockID{}))
+
+	record := logs.FindLog(testlog.NewMessageFilter("Created channel"))
+	require.NotNil(t, record)
+	require.Equal(t, "test-blobs", record.AttrValue("channel_config"))
+}
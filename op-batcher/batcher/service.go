@@ -191,6 +191,7 @@ func (bs *BatcherService) initRollupConfig(ctx context.Context) error {
 
 func (bs *BatcherService) initChannelConfig(cfg *CLIConfig) error {
 	cc := ChannelConfig{
+		Name:               cfg.DataAvailabilityType.String(),
 		SeqWindowSize:      bs.RollupConfig.SeqWindowSize,
 		ChannelTimeout:     bs.RollupConfig.ChannelTimeout,
 		MaxChannelDuration: cfg.MaxChannelDuration,
@@ -236,6 +237,7 @@ func (bs *BatcherService) initChannelConfig(cfg *CLIConfig) error {
 		return fmt.Errorf("invalid channel configuration: %w", err)
 	}
 	bs.Log.Info("Initialized channel-config",
+		"name", cc.Name,
 		"use_blobs", bs.UseBlobs,
 		"use_plasma", bs.UsePlasma,
 		"max_frame_size", cc.MaxFrameSize,
@@ -0,0 +1,142 @@
+package benchmarks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+	"github.com/stretchr/testify/require"
+)
+
+// maxRLPBytesPerChannel is the Fjord limit, large enough to never limit the benchmark channels
+const maxRLPBytesPerChannel = 100_000_000
+
+// BatchReadingBenchmarkTC is a test case for the batch reading benchmark
+type BatchReadingBenchmarkTC struct {
+	BatchType  uint
+	Algo       derive.CompressionAlgo
+	BatchCount int
+	txPerBatch int
+}
+
+func (t BatchReadingBenchmarkTC) String() string {
+	var btype string
+	if t.BatchType == derive.SingularBatchType {
+		btype = "Singular"
+	}
+	if t.BatchType == derive.SpanBatchType {
+		btype = "Span"
+	}
+	return fmt.Sprintf("BatchType=%s, Algo=%s, BatchCount=%d, txPerBatch=%d", btype, t.Algo, t.BatchCount, t.txPerBatch)
+}
+
+// BenchmarkBatchReader measures the throughput of decoding channel data into batches, which is
+// the decoding work the ChannelInReader does per channel. It reports bytes/s of channel data,
+// batches/s and allocations.
+func BenchmarkBatchReader(b *testing.B) {
+	chainID := big.NewInt(333)
+	tests := []BatchReadingBenchmarkTC{}
+	for _, bt := range []uint{derive.SingularBatchType, derive.SpanBatchType} {
+		for _, algo := range compAlgos {
+			for _, batchCount := range []int{1, 10, 100} {
+				tests = append(tests, BatchReadingBenchmarkTC{bt, algo, batchCount, 10})
+			}
+		}
+	}
+
+	// The channels are built lazily, so that filtered runs only build the channels they decode.
+	// The batches are shared by the channels of all algorithms.
+	type batchesKey struct {
+		batchType  uint
+		batchCount int
+	}
+	batchesCache := make(map[batchesKey][]*derive.BatchData)
+	channels := make(map[BatchReadingBenchmarkTC][]byte)
+	channelData := func(b *testing.B, tc BatchReadingBenchmarkTC) []byte {
+		if data, ok := channels[tc]; ok {
+			return data
+		}
+		key := batchesKey{tc.BatchType, tc.BatchCount}
+		batches, ok := batchesCache[key]
+		if !ok {
+			// Seed per key, so the batches don't depend on which benchmarks run.
+			rng := rand.New(rand.NewSource(0x543331 + int64(tc.BatchType)<<32 + int64(tc.BatchCount)))
+			var err error
+			batches, err = derive.RandomChannelBatches(rng, int(tc.BatchType), tc.BatchCount, tc.txPerBatch, chainID)
+			require.NoError(b, err)
+			batchesCache[key] = batches
+		}
+		data, err := derive.ChannelData(tc.Algo, batches...)
+		require.NoError(b, err)
+		channels[tc] = data
+		return data
+	}
+
+	for _, tc := range tests {
+		b.Run(tc.String(), func(b *testing.B) {
+			data := channelData(b, tc)
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for bn := 0; bn < b.N; bn++ {
+				readAllBatches(b, data)
+			}
+			b.ReportMetric(float64(b.N*tc.BatchCount)/b.Elapsed().Seconds(), "batches/s")
+		})
+	}
+}
+
+// BenchmarkBatchReaderBufferSize measures the effect of the read buffer size on the throughput
+// of decoding a large channel.
+func BenchmarkBatchReaderBufferSize(b *testing.B) {
+	// The batches and channels are built lazily, like in BenchmarkBatchReader.
+	var batches []*derive.BatchData
+	channels := make(map[derive.CompressionAlgo][]byte)
+	channelData := func(b *testing.B, algo derive.CompressionAlgo) []byte {
+		if data, ok := channels[algo]; ok {
+			return data
+		}
+		if batches == nil {
+			rng := rand.New(rand.NewSource(0x543331))
+			var err error
+			batches, err = derive.RandomChannelBatches(rng, derive.SingularBatchType, 1000, 10, big.NewInt(333))
+			require.NoError(b, err)
+		}
+		data, err := derive.ChannelData(algo, batches...)
+		require.NoError(b, err)
+		channels[algo] = data
+		return data
+	}
+
+	for _, algo := range compAlgos {
+		for _, size := range []int{0, 4 << 10, 64 << 10, 1 << 20} {
+			b.Run(fmt.Sprintf("Algo=%s, BufferSize=%d", algo, size), func(b *testing.B) {
+				data := channelData(b, algo)
+				b.SetBytes(int64(len(data)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for bn := 0; bn < b.N; bn++ {
+					readAllBatches(b, data, derive.WithReadBufferSize(size))
+				}
+			})
+		}
+	}
+}
+
+// readAllBatches decodes all batches of the channel data.
+func readAllBatches(b *testing.B, data []byte, opts ...derive.BatchReaderOption) {
+	readBatch, err := derive.BatchReader(bytes.NewReader(data), maxRLPBytesPerChannel, true, opts...)
+	require.NoError(b, err)
+	for {
+		_, err := readBatch()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		require.NoError(b, err)
+	}
+}
@@ -62,6 +62,7 @@ type Metricer interface {
 	RecordSequencerSealingTime(duration time.Duration)
 	Document() []metrics.DocumentedMetric
 	RecordChannelInputBytes(num int)
+	RecordChannelCompressionRatio(ratio float64)
 	RecordHeadChannelOpened()
 	RecordChannelTimedOut()
 	RecordFrame()
@@ -153,7 +154,8 @@ type Metrics struct {
 	Accepts           *prometheus.CounterVec
 	PeerScores        *prometheus.HistogramVec
 
-	ChannelInputBytes prometheus.Counter
+	ChannelInputBytes       prometheus.Counter
+	ChannelCompressionRatio prometheus.Histogram
 
 	// Protocol version reporting
 	// Delta = params.ProtocolVersionComparison
@@ -335,6 +337,12 @@ func NewMetrics(procName string) *Metrics {
 			Name:      "channel_input_bytes",
 			Help:      "Number of compressed bytes added to the channel",
 		}),
+		ChannelCompressionRatio: factory.NewHistogram(prometheus.HistogramOpts{
+			Namespace: ns,
+			Name:      "channel_compression_ratio",
+			Buckets:   []float64{1, 1.5, 2, 2.5, 3, 3.5, 4, 5, 6, 8, 10, 15, 20},
+			Help:      "Histogram of the ratio of decompressed to compressed bytes of drained channels",
+		}),
 
 		P2PReqDurationSeconds: factory.NewHistogramVec(prometheus.HistogramOpts{
 			Namespace: ns,
@@ -628,6 +636,10 @@ func (m *Metrics) RecordChannelInputBytes(inputCompressedBytes int) {
 	m.ChannelInputBytes.Add(float64(inputCompressedBytes))
 }
 
+func (m *Metrics) RecordChannelCompressionRatio(ratio float64) {
+	m.ChannelCompressionRatio.Observe(ratio)
+}
+
 func (m *Metrics) RecordHeadChannelOpened() {
 	m.headChannelOpenedEvent.Record()
 }
@@ -780,6 +792,9 @@ func (n *noopMetricer) PayloadsQuarantineSize(int) {
 func (n *noopMetricer) RecordChannelInputBytes(int) {
 }
 
+func (n *noopMetricer) RecordChannelCompressionRatio(float64) {
+}
+
 func (n *noopMetricer) RecordHeadChannelOpened() {
 }
 
@@ -0,0 +1,806 @@
+package derive
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// ErrFrameCountMismatch is returned if the frame count prefix of a channel doesn't match
+// the number of frames the caller assembled the channel from.
+var ErrFrameCountMismatch = errors.New("frame count prefix mismatch")
+
+// ErrChainIDMismatch is returned if the chain id guard of a channel doesn't match the expected chain id.
+var ErrChainIDMismatch = errors.New("channel chain id mismatch")
+
+// ErrBatchDecodePanic is returned if decoding a batch panicked, and the panic was recovered.
+var ErrBatchDecodePanic = errors.New("panic while decoding batch")
+
+// ErrTruncatedChannel is returned if the channel data ends in the middle of a batch,
+// or in the middle of the compressed stream.
+var ErrTruncatedChannel = errors.New("truncated channel")
+
+// ErrTooManyBatchElements is returned if a batch exceeds the cap set with WithMaxBatchElements.
+var ErrTooManyBatchElements = errors.New("too many batch elements")
+
+// ErrChannelTooLarge is returned by ChannelInReader.WriteChannel in strict mode, if the channel
+// data exceeds the capacity set with ChannelInReader.SetChannelCapacity.
+var ErrChannelTooLarge = errors.New("channel data exceeds capacity")
+
+// ErrChannelLengthMismatch is returned by ChannelInReader.WriteChannelChunk if the chunks of
+// a channel don't add up to the declared total length.
+var ErrChannelLengthMismatch = errors.New("channel chunks don't match declared length")
+
+// ErrUnknownContainerVersion is returned for container format channels with an unknown format version.
+var ErrUnknownContainerVersion = errors.New("unknown channel container version")
+
+// ErrChannelFooterMismatch is returned if the footer of a channel is missing, or doesn't match
+// the batches of the channel, if footers are enabled with WithChannelFooter.
+var ErrChannelFooterMismatch = errors.New("channel footer mismatch")
+
+// ErrChannelAttestation is returned if the attestation of a channel is missing, or isn't the
+// last item of the channel, if attestations are enabled with WithChannelAttestation.
+var ErrChannelAttestation = errors.New("invalid channel attestation")
+
+// ErrUncompressedSizeExceeded is returned if the decompressed data of a channel exceeds the
+// uncompressed size declared by its size hint, see WithUncompressedSizeHint.
+var ErrUncompressedSizeExceeded = errors.New("decompressed data exceeds declared uncompressed size")
+
+// ErrEmptyBatch is returned for zero-length batches if the EmptyBatchError policy is used.
+var ErrEmptyBatch = errors.New("empty batch")
+
+// ChannelContainerMagic starts channels in the container format accepted by batch readers
+// created with WithChannelContainers. The magic is followed by a container version byte, and
+// then the channel data, which starts with the usual compression version byte.
+// The first byte of the magic is not a valid canonical channel version.
+const ChannelContainerMagic = "CHNL"
+
+const (
+	// ContainerVersionRLP containers carry the canonical RLP batch stream.
+	ContainerVersionRLP byte = 0x01
+	// ContainerVersionLengthPrefixed containers carry length-prefixed batches,
+	// as read with WithLengthPrefixedBatches.
+	ContainerVersionLengthPrefixed byte = 0x02
+)
+
+// ChannelFooterType is the reserved batch type of channel footers, as read with WithChannelFooter.
+const ChannelFooterType = 0xfe
+
+// ChannelAttestationType is the reserved batch type of channel attestations, as read with
+// WithChannelAttestation.
+const ChannelAttestationType = 0xfd
+
+// ErrBatchOrder is returned if batch timestamps decrease, for batch types selected with
+// WithMonotonicTimestamps.
+var ErrBatchOrder = errors.New("batch timestamps out of order")
+
+// ErrLargeBatch is passed to the warning sink for batches exceeding the large batch threshold.
+var ErrLargeBatch = errors.New("unusually large batch")
+
+// ErrNothingToRewind is returned when rewinding a batch reader that has no batch to re-read.
+var ErrNothingToRewind = errors.New("no batch to rewind")
+
+// EmptyBatchPolicy controls how the batch reader handles zero-length batches.
+type EmptyBatchPolicy uint8
+
+const (
+	// EmptyBatchPassThrough decodes empty batches like any other batch. This is the canonical
+	// behavior, so decoding fails the same way it does for any other invalid batch.
+	EmptyBatchPassThrough EmptyBatchPolicy = iota
+	// EmptyBatchSkip skips empty batches and continues with the next batch.
+	EmptyBatchSkip
+	// EmptyBatchError fails with ErrEmptyBatch on empty batches.
+	EmptyBatchError
+)
+
+// BatchReaderOption configures optional behavior of the batch reader created by BatchReader.
+// These options exist for tooling and debugging. The derivation pipeline doesn't pass any of
+// them, but note that panic recovery is enabled by default, see WithPanicRecovery. So the
+// pipeline drops a channel whose decoding panics, instead of crashing.
+type BatchReaderOption func(cfg *batchReaderConfig)
+
+type batchReaderConfig struct {
+	// checksums are the expected keccak256 hashes of the canonical encoding of each batch,
+	// in channel order.
+	checksums []common.Hash
+	// uncompressed enables decoding of ChannelVersionUncompressed channels.
+	uncompressed bool
+	// frameCountPrefix enables reading an RLP frame count ahead of the batches.
+	frameCountPrefix bool
+	// assembledFrames is the number of frames the channel was assembled from.
+	// Zero if unknown, in which case the frame count prefix is not validated.
+	assembledFrames uint64
+	// chainID is the expected chain id of the chain id guard. Nil if the guard is disabled.
+	chainID *big.Int
+	// recoverPanics converts panics during batch decoding into errors.
+	recoverPanics bool
+	// emptyBatches is the policy for zero-length batches.
+	emptyBatches EmptyBatchPolicy
+	// maxElements caps the number of list elements per batch. Zero means no cap.
+	maxElements uint64
+	// blockHints enables skipping L2 block hint items interleaved with the batches.
+	blockHints bool
+	// onBlockHint is called with the raw RLP encoding of each L2 block hint, if not nil.
+	onBlockHint func(hint []byte)
+	// log logs every decoded batch at trace level, if not nil.
+	log log.Logger
+	// lengthPrefixed enables reading batches framed by a 4-byte length prefix.
+	lengthPrefixed bool
+	// containers enables detection of the channel container format.
+	containers bool
+	// footer enables reading and validating a channel footer after the last batch.
+	footer bool
+	// monotonicTypes are the batch types whose timestamps must not decrease within a channel.
+	monotonicTypes []int
+	// attestation enables reading a channel attestation after the last batch.
+	attestation bool
+	// onAttestation is called with the attestation of the channel, if not nil.
+	onAttestation func(attestation []byte)
+	// sizeHint enables reading an uncompressed size hint ahead of the compressed channel data.
+	sizeHint bool
+	// warn is called with non-fatal anomalies, if not nil.
+	warn func(warning error)
+	// largeBatchSize is the encoded batch size above which a batch is reported as large.
+	// Zero disables the warning.
+	largeBatchSize uint64
+	// batchTypes decodes the batches, if not nil. Otherwise only the built-in types are decoded.
+	batchTypes *BatchTypeRegistry
+	// readBufferSize is the size of the buffer of the decompressed data. Zero means the default.
+	readBufferSize int
+}
+
+func newBatchReaderConfig(opts []BatchReaderOption) *batchReaderConfig {
+	cfg := &batchReaderConfig{
+		recoverPanics: true,
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// maxHintedReadBufferSize caps the read buffer sized by an uncompressed size hint, as the hint
+// is read from the channel data and can't be trusted.
+const maxHintedReadBufferSize = 64 << 10
+
+// bufferSize returns the size of the buffer of the decompressed data, or zero for the default.
+// Without an explicit read buffer size, the buffer is sized by the uncompressed size hint, if any.
+func (cfg *batchReaderConfig) bufferSize(sizeHint uint64) int {
+	if cfg.readBufferSize != 0 || !cfg.sizeHint {
+		return cfg.readBufferSize
+	}
+	return int(min(sizeHint, maxHintedReadBufferSize))
+}
+
+// quiet returns a copy of the config without callbacks, to decode a channel again
+// without repeating side effects.
+func (cfg *batchReaderConfig) quiet() *batchReaderConfig {
+	cpy := *cfg
+	cpy.onBlockHint = nil
+	cpy.log = nil
+	cpy.warn = nil
+	cpy.onAttestation = nil
+	return &cpy
+}
+
+// WithBatchChecksums makes the batch reader hash the canonical re-encoding of each decoded
+// batch and compare it against the checksum at the same index. A mismatch is returned as a
+// *BatchChecksumError. Batches beyond the end of the list are not validated.
+// The checksums are checked against every channel decoded with the option, so it is meant for
+// decoding a single channel with BatchReader. A ChannelInReader takes the checksums of each
+// channel with ChannelInReader.SetBatchChecksums instead.
+func WithBatchChecksums(checksums []common.Hash) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.checksums = checksums
+	}
+}
+
+// WithUncompressedChannels makes the batch reader accept channels starting with the
+// ChannelVersionUncompressed version byte, and read their RLP batch stream directly.
+func WithUncompressedChannels() BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.uncompressed = true
+	}
+}
+
+// WithFrameCountPrefix makes the batch reader read a frame count, encoded as an RLP integer,
+// before the first batch of the channel. This is used by some variant channel encoders.
+// If assembledFrames is non-zero, the prefix must match it, otherwise creating the
+// batch reader fails with ErrFrameCountMismatch. A ChannelInReader applies the same
+// assembledFrames to every channel, so it should be zero there, with the frame count of each
+// channel checked by ChannelInReader.ValidateFrameCount instead.
+func WithFrameCountPrefix(assembledFrames uint64) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.frameCountPrefix = true
+		cfg.assembledFrames = assembledFrames
+	}
+}
+
+// WithChainIDGuard makes the batch reader read a chain id, encoded as an RLP integer, before
+// the first batch of the channel, and any frame count prefix. This is used by an experimental
+// channel format, so that data of the wrong chain can't be misapplied. If the chain id doesn't
+// match the expected chain id, creating the batch reader fails with ErrChainIDMismatch.
+func WithChainIDGuard(expected *big.Int) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.chainID = expected
+	}
+}
+
+// WithPanicRecovery controls whether panics while decoding a batch are recovered and
+// returned as ErrBatchDecodePanic errors, so a single malformed channel can't crash the
+// node. Panic recovery is enabled by default, including in the derivation pipeline, which
+// drops the channel like any other channel that fails to decode.
+// Panics of callbacks passed with other options are not recovered.
+func WithPanicRecovery(enabled bool) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.recoverPanics = enabled
+	}
+}
+
+// WithEmptyBatchPolicy sets how the batch reader handles zero-length batches.
+// The default is EmptyBatchPassThrough.
+func WithEmptyBatchPolicy(policy EmptyBatchPolicy) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.emptyBatches = policy
+	}
+}
+
+// WithMaxBatchElements caps the number of list elements per batch, to bound the decoding work
+// spent on list-heavy batches. Elements are the transactions of a singular batch, or the
+// blocks and transactions of a span batch. Batches exceeding the cap fail with
+// ErrTooManyBatchElements. A cap of zero disables the check.
+func WithMaxBatchElements(maxElements uint64) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.maxElements = maxElements
+	}
+}
+
+// WithL2BlockHints enables decoding of an experimental channel format that interleaves
+// L2 block hints with the batches. Batches are RLP strings, while hints are RLP lists.
+// Hints are skipped, and passed to onHint with their raw RLP encoding if onHint is not nil.
+func WithL2BlockHints(onHint func(hint []byte)) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.blockHints = true
+		cfg.onBlockHint = onHint
+	}
+}
+
+// WithLengthPrefixedBatches enables decoding of a tooling channel format, in which each batch
+// is framed by its length as a 4-byte big-endian integer, followed by the RLP encoding of the
+// batch. The frame count prefix, if enabled, is read before the first frame. Empty batch
+// policies and L2 block hints only apply to the plain RLP batch stream, not to framed batches.
+func WithLengthPrefixedBatches() BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.lengthPrefixed = true
+	}
+}
+
+// WithChannelContainers makes the batch reader accept channels in the container format, which
+// start with ChannelContainerMagic and a container version that selects the batch encoding.
+// Canonical channels without the magic are still decoded as usual.
+func WithChannelContainers() BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.containers = true
+	}
+}
+
+// WithBatchLogging makes the batch reader log the index, type and encoded size of every
+// decoded batch to lgr at trace level, for debugging derivation.
+func WithBatchLogging(lgr log.Logger) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.log = lgr
+	}
+}
+
+// WithChannelFooter makes the batch reader expect a footer after the last batch of each channel.
+// The footer is encoded like a batch of the reserved ChannelFooterType, followed by the RLP
+// encoding of the number of batches in the channel. The batch reader returns io.EOF at the
+// footer, if the count matches and the footer ends the channel. Otherwise, or if the footer is
+// missing, it returns an ErrChannelFooterMismatch error.
+func WithChannelFooter() BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.footer = true
+	}
+}
+
+// WithMonotonicTimestamps makes the batch reader check that the timestamps of the batches of
+// the given batch types don't decrease within a channel, to catch malformed channels early.
+// Singular batches are compared by timestamp, and span batches by their start timestamp.
+// Violations fail with ErrBatchOrder.
+func WithMonotonicTimestamps(batchTypes ...int) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.monotonicTypes = batchTypes
+	}
+}
+
+// WithWarningSink makes the batch reader pass non-fatal anomalies to sink, without stopping
+// decoding, so tools can collect diagnostics. Warnings are errors wrapping ErrEmptyBatch, for
+// empty batches skipped with the EmptyBatchSkip policy, and ErrLargeBatch, for batches with an
+// encoded size above largeBatchSize. A largeBatchSize of zero disables the large batch warning.
+func WithWarningSink(sink func(warning error), largeBatchSize uint64) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.warn = sink
+		cfg.largeBatchSize = largeBatchSize
+	}
+}
+
+// WithChannelAttestation makes the batch reader expect an attestation, e.g. a signature,
+// after the last batch of each channel, as used by an experimental channel format.
+// The attestation is encoded like a batch of the reserved ChannelAttestationType, followed by
+// the raw attestation bytes. The batch reader passes the attestation to onAttestation if not
+// nil, and returns io.EOF, if the attestation ends the channel. Otherwise, or if the
+// attestation is missing, it returns an ErrChannelAttestation error.
+// Attestations can't be combined with footers, which must end the channel as well. Creating a
+// batch reader with both fails with an ErrChannelAttestation error.
+func WithChannelAttestation(onAttestation func(attestation []byte)) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.attestation = true
+		cfg.onAttestation = onAttestation
+	}
+}
+
+// WithUncompressedSizeHint makes the batch reader read the uncompressed size of the channel,
+// encoded as an unsigned varint, ahead of the compressed channel data, and after the container
+// header, if any. Decompressing more data than declared fails with ErrUncompressedSizeExceeded,
+// which protects against decompression bombs. The hint also sizes the buffer of the
+// decompressed data, up to a cap, unless set with WithReadBufferSize.
+// Decompressed data shorter than the declared size is accepted.
+func WithUncompressedSizeHint() BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.sizeHint = true
+	}
+}
+
+// WithBatchTypeRegistry makes the batch reader decode batches with the batch types of the
+// registry, which allows decoding custom batch types next to the built-in types.
+func WithBatchTypeRegistry(reg *BatchTypeRegistry) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.batchTypes = reg
+	}
+}
+
+// WithReadBufferSize sets the size of the buffered reader wrapping the decompressed channel data.
+// A larger buffer reduces the number of reads from the decompressor, which can improve the
+// decoding throughput of large channels. Zero keeps the default buffering.
+func WithReadBufferSize(size int) BatchReaderOption {
+	return func(cfg *batchReaderConfig) {
+		cfg.readBufferSize = size
+	}
+}
+
+// BatchChecksumError is returned by the batch reader if a decoded batch doesn't match the
+// checksum supplied with WithBatchChecksums.
+type BatchChecksumError struct {
+	Index    int
+	Expected common.Hash
+	Actual   common.Hash
+}
+
+func (e *BatchChecksumError) Error() string {
+	return fmt.Sprintf("batch %d checksum mismatch: expected %s, got %s", e.Index, e.Expected, e.Actual)
+}
+
+// checkBatch validates the batch at the given index in the channel against the configured checks.
+func (cfg *batchReaderConfig) checkBatch(index int, batchData *BatchData) error {
+	if cfg.maxElements != 0 {
+		if count := batchElementCount(batchData); count > cfg.maxElements {
+			return fmt.Errorf("%w: batch %d has %d elements, max %d", ErrTooManyBatchElements, index, count, cfg.maxElements)
+		}
+	}
+	if index < len(cfg.checksums) {
+		data, err := batchData.MarshalBinary()
+		if err != nil {
+			return fmt.Errorf("failed to re-encode batch %d: %w", index, err)
+		}
+		if actual := crypto.Keccak256Hash(data); actual != cfg.checksums[index] {
+			return &BatchChecksumError{Index: index, Expected: cfg.checksums[index], Actual: actual}
+		}
+	}
+	return nil
+}
+
+// checkOrder checks that the timestamp of the batch doesn't decrease compared to the
+// previous batch of the same type, if enabled for the batch type.
+func (br *batchReader) checkOrder(batchData *BatchData) error {
+	batchType := int(batchData.GetBatchType())
+	if !slices.Contains(br.cfg.monotonicTypes, batchType) {
+		return nil
+	}
+	var timestamp uint64
+	switch inner := batchData.inner.(type) {
+	case *SingularBatch:
+		timestamp = inner.Timestamp
+	case *RawSpanBatch:
+		timestamp = inner.relTimestamp
+	default:
+		return nil
+	}
+	if br.lastTimestamps == nil {
+		br.lastTimestamps = make(map[int]uint64)
+	}
+	if last, ok := br.lastTimestamps[batchType]; ok && timestamp < last {
+		return fmt.Errorf("%w: batch %d has timestamp %d, previous batch of type %d has %d", ErrBatchOrder, br.index, timestamp, batchType, last)
+	}
+	br.lastTimestamps[batchType] = timestamp
+	return nil
+}
+
+// batchElementCount returns the number of list elements of the batch.
+func batchElementCount(batchData *BatchData) uint64 {
+	switch inner := batchData.inner.(type) {
+	case *SingularBatch:
+		return uint64(len(inner.Transactions))
+	case *RawSpanBatch:
+		count := inner.blockCount
+		for _, txCount := range inner.blockTxCounts {
+			count += txCount
+		}
+		return count
+	default:
+		return 0
+	}
+}
+
+// batchReader iteratively decodes batches from the RLP stream of a channel.
+type batchReader struct {
+	cfg       *batchReaderConfig
+	comprAlgo CompressionAlgo
+	rlp       *rlp.Stream
+	// decompressed counts the decompressed bytes read from the channel.
+	decompressed *countingReader
+	// framed is the decompressed channel data, if batches are length-prefixed.
+	// It is shared with the RLP reader, which is used for the frame count prefix.
+	framed *bufio.Reader
+	// framedBudget is the number of bytes left to read in framed batches,
+	// to enforce the same limit as the RLP reader.
+	framedBudget uint64
+
+	// index is the number of batches read so far.
+	index int
+	// trailerRead is set once the channel footer or attestation has been read and validated.
+	trailerRead bool
+	// lastTimestamps are the timestamps of the last batch of each batch type with
+	// monotonic timestamps.
+	lastTimestamps map[int]uint64
+	// frameCount is the frame count read from the channel prefix, if enabled.
+	frameCount uint64
+	// last is the last batch read, to be returned again after a rewind.
+	last *BatchData
+	// rewound is set if the next read returns the last batch again.
+	rewound bool
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+// sizeLimitReader fails reads beyond the declared uncompressed size of a channel.
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining uint64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.remaining == 0 {
+		// Check for data beyond the declared size.
+		var b [1]byte
+		if n, err := l.r.Read(b[:]); n > 0 {
+			return 0, ErrUncompressedSizeExceeded
+		} else {
+			return 0, err
+		}
+	}
+	if uint64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= uint64(n)
+	return n, err
+}
+
+// readBatch reads the next batch from the channel.
+// It returns io.EOF once all batches have been read.
+func (br *batchReader) readBatch() (*BatchData, error) {
+	if br.rewound {
+		br.rewound = false
+		br.index++
+		return br.last, nil
+	}
+	br.last = nil
+	if br.trailerRead {
+		return nil, io.EOF
+	}
+	data, err := br.readBatchBytes()
+	if err == io.EOF && br.cfg.footer {
+		return nil, fmt.Errorf("%w: channel has no footer", ErrChannelFooterMismatch)
+	} else if err == io.EOF && br.cfg.attestation {
+		return nil, fmt.Errorf("%w: channel has no attestation", ErrChannelAttestation)
+	} else if err != nil {
+		return nil, classifyTruncation(err)
+	}
+	if br.cfg.footer && len(data) > 0 && data[0] == ChannelFooterType {
+		return nil, br.readFooter(data[1:])
+	}
+	if br.cfg.attestation && len(data) > 0 && data[0] == ChannelAttestationType {
+		return nil, br.readAttestation(data[1:])
+	}
+	if br.cfg.warn != nil && br.cfg.largeBatchSize != 0 && uint64(len(data)) > br.cfg.largeBatchSize {
+		br.cfg.warn(fmt.Errorf("%w: batch %d has %d bytes, threshold %d", ErrLargeBatch, br.index, len(data), br.cfg.largeBatchSize))
+	}
+	batchData := BatchData{ComprAlgo: br.comprAlgo}
+	if err := br.safeDecode(func() error { return br.decodeBatch(&batchData, data) }); err != nil {
+		return nil, classifyTruncation(err)
+	}
+	if err := br.cfg.checkBatch(br.index, &batchData); err != nil {
+		return nil, err
+	}
+	if err := br.checkOrder(&batchData); err != nil {
+		return nil, err
+	}
+	if br.cfg.log != nil {
+		br.cfg.log.Trace("Decoded batch", "index", br.index, "type", batchData.GetBatchType(), "size", len(data))
+	}
+	br.index++
+	br.last = &batchData
+	return &batchData, nil
+}
+
+// rewind makes the next read return the last batch read again. Only a single batch can be
+// rewound, and only if the last read succeeded. Otherwise ErrNothingToRewind is returned.
+func (br *batchReader) rewind() error {
+	if br.last == nil || br.rewound {
+		return ErrNothingToRewind
+	}
+	br.rewound = true
+	br.index--
+	return nil
+}
+
+// safeDecode calls decode, and returns a panic during decoding as an ErrBatchDecodePanic error,
+// if panic recovery is enabled. Only decoding is covered, so panics of callbacks propagate.
+func (br *batchReader) safeDecode(decode func() error) (err error) {
+	if br.cfg.recoverPanics {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("%w: %v", ErrBatchDecodePanic, r)
+			}
+		}()
+	}
+	return decode()
+}
+
+// decodeBatch decodes the typed batch data into batchData, with the registered batch types if
+// a registry is configured.
+func (br *batchReader) decodeBatch(batchData *BatchData, data []byte) error {
+	if br.cfg.batchTypes != nil {
+		return br.cfg.batchTypes.decode(batchData, data)
+	}
+	return batchData.decodeTyped(data)
+}
+
+// readBatchBytes reads the binary encoding of the next batch.
+// It returns io.EOF if there are no more batches.
+func (br *batchReader) readBatchBytes() ([]byte, error) {
+	if br.framed != nil {
+		return br.readFrame()
+	}
+	if err := br.skipNonBatchItems(); err != nil {
+		return nil, err
+	}
+	return br.rlp.Bytes()
+}
+
+// readInto decodes the next RLP item of the channel into dest, bypassing batch decoding and
+// checks. It returns io.EOF once all items have been read.
+func (br *batchReader) readInto(dest any) (err error) {
+	if br.rewound {
+		// Serve the rewound batch by its canonical encoding.
+		br.rewound = false
+		var data []byte
+		if data, err = rlp.EncodeToBytes(br.last); err == nil {
+			err = br.safeDecode(func() error { return rlp.DecodeBytes(data, dest) })
+		}
+		br.last = nil
+		if err != nil {
+			return err
+		}
+		br.index++
+		return nil
+	}
+	br.last = nil
+	if br.trailerRead {
+		return io.EOF
+	}
+	if br.framed != nil {
+		var data []byte
+		if data, err = br.readFrameData(); err == nil {
+			err = br.safeDecode(func() error { return rlp.DecodeBytes(data, dest) })
+		}
+	} else {
+		err = br.safeDecode(func() error { return br.rlp.Decode(dest) })
+	}
+	if err != nil {
+		return classifyTruncation(err)
+	}
+	br.index++
+	return nil
+}
+
+// readFrame reads the next length-prefixed batch, and returns the binary encoding of the batch.
+// It returns io.EOF if the channel ends at a frame boundary.
+func (br *batchReader) readFrame() ([]byte, error) {
+	data, err := br.readFrameData()
+	if err != nil {
+		return nil, err
+	}
+	kind, content, rest, err := rlp.Split(data)
+	if err != nil {
+		return nil, err
+	}
+	if kind != rlp.String {
+		return nil, rlp.ErrExpectedString
+	}
+	if len(rest) != 0 {
+		return nil, rlp.ErrMoreThanOneValue
+	}
+	return content, nil
+}
+
+// readFrameData reads the next length-prefixed frame, and returns the RLP item it contains.
+// It returns io.EOF if the channel ends at a frame boundary.
+func (br *batchReader) readFrameData() ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(br.framed, prefix[:]); err != nil {
+		return nil, err
+	}
+	size := uint64(binary.BigEndian.Uint32(prefix[:]))
+	if size > br.framedBudget {
+		return nil, fmt.Errorf("batch frame of %d bytes exceeds remaining channel limit of %d bytes: %w", size, br.framedBudget, rlp.ErrValueTooLarge)
+	}
+	br.framedBudget -= size
+	data := make([]byte, size)
+	if _, err := io.ReadFull(br.framed, data); err == io.EOF {
+		return nil, io.ErrUnexpectedEOF
+	} else if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// readFooter validates the channel footer against the number of batches read, and checks that
+// the footer ends the channel. It returns io.EOF if the footer is valid.
+func (br *batchReader) readFooter(footer []byte) error {
+	var count uint64
+	if err := rlp.DecodeBytes(footer, &count); err != nil {
+		return fmt.Errorf("invalid channel footer: %w", err)
+	}
+	if count != uint64(br.index) {
+		return fmt.Errorf("%w: footer declares %d batches, read %d", ErrChannelFooterMismatch, count, br.index)
+	}
+	if _, err := br.readBatchBytes(); err != io.EOF {
+		return fmt.Errorf("%w: channel continues after footer", ErrChannelFooterMismatch)
+	}
+	br.trailerRead = true
+	return io.EOF
+}
+
+// readAttestation checks that the attestation ends the channel, and passes it to the
+// attestation callback. It returns io.EOF if the attestation is valid.
+func (br *batchReader) readAttestation(attestation []byte) error {
+	if _, err := br.readBatchBytes(); err != io.EOF {
+		return fmt.Errorf("%w: channel continues after attestation", ErrChannelAttestation)
+	}
+	br.trailerRead = true
+	if br.cfg.onAttestation != nil {
+		br.cfg.onAttestation(attestation)
+	}
+	return io.EOF
+}
+
+// classifyTruncation wraps unexpected-EOF errors of the decompressor or RLP decoder
+// in ErrTruncatedChannel, to distinguish truncated channels from fully read ones.
+func classifyTruncation(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: %w", ErrTruncatedChannel, err)
+	}
+	return err
+}
+
+// skipNonBatchItems consumes the items ahead of the next batch in the RLP stream:
+// empty batches, according to the empty batch policy, and L2 block hints, if enabled.
+func (br *batchReader) skipNonBatchItems() error {
+	if br.cfg.emptyBatches == EmptyBatchPassThrough && !br.cfg.blockHints {
+		return nil
+	}
+	for {
+		kind, size, err := br.rlp.Kind()
+		if err != nil {
+			return err
+		}
+		switch {
+		case kind == rlp.List && br.cfg.blockHints:
+			hint, err := br.rlp.Raw()
+			if err != nil {
+				return err
+			}
+			if br.cfg.onBlockHint != nil {
+				br.cfg.onBlockHint(hint)
+			}
+		case kind == rlp.String && size == 0 && br.cfg.emptyBatches != EmptyBatchPassThrough:
+			if br.cfg.emptyBatches == EmptyBatchError {
+				return fmt.Errorf("%w after batch %d", ErrEmptyBatch, br.index)
+			}
+			if br.cfg.warn != nil {
+				br.cfg.warn(fmt.Errorf("%w skipped after batch %d", ErrEmptyBatch, br.index))
+			}
+			if _, err := br.rlp.Bytes(); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+	}
+}
+
+// readContainerHeader consumes the container header at the start of the channel data, if any.
+// It returns whether the channel is a container, and whether its batches are length-prefixed.
+func readContainerHeader(r *bufio.Reader) (container bool, lengthPrefixed bool, err error) {
+	header, err := r.Peek(len(ChannelContainerMagic) + 1)
+	if err != nil || string(header[:len(ChannelContainerMagic)]) != ChannelContainerMagic {
+		// Not a container, leave it to the compression detection to handle short channels.
+		return false, false, nil
+	}
+	switch version := header[len(ChannelContainerMagic)]; version {
+	case ContainerVersionRLP:
+	case ContainerVersionLengthPrefixed:
+		lengthPrefixed = true
+	default:
+		return false, false, fmt.Errorf("%w: %d", ErrUnknownContainerVersion, version)
+	}
+	if _, err := r.Discard(len(header)); err != nil {
+		return false, false, err
+	}
+	return true, lengthPrefixed, nil
+}
+
+// readChainID reads the chain id guard of the channel and checks it against the expected chain id.
+func (br *batchReader) readChainID() error {
+	chainID, err := br.rlp.BigInt()
+	if err != nil {
+		return fmt.Errorf("failed to read chain id guard: %w", err)
+	}
+	if chainID.Cmp(br.cfg.chainID) != 0 {
+		return fmt.Errorf("%w: channel is for chain %d, expected %d", ErrChainIDMismatch, chainID, br.cfg.chainID)
+	}
+	return nil
+}
+
+// readFrameCount reads and validates the frame count prefix of the channel.
+func (br *batchReader) readFrameCount() error {
+	count, err := br.rlp.Uint64()
+	if err != nil {
+		return fmt.Errorf("failed to read frame count prefix: %w", err)
+	}
+	if expected := br.cfg.assembledFrames; expected != 0 && count != expected {
+		return fmt.Errorf("%w: prefix declares %d frames, assembled %d", ErrFrameCountMismatch, count, expected)
+	}
+	br.frameCount = count
+	return nil
+}
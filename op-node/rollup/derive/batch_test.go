@@ -10,7 +10,6 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/rlp"
 
 	"github.com/ethereum-optimism/optimism/op-node/rollup"
@@ -18,64 +17,6 @@ import (
 	"github.com/ethereum-optimism/optimism/op-service/testutils"
 )
 
-func RandomRawSpanBatch(rng *rand.Rand, chainId *big.Int) *RawSpanBatch {
-	blockCount := uint64(4 + rng.Int()&0xFF) // at least 4
-	originBits := new(big.Int)
-	for i := 0; i < int(blockCount); i++ {
-		bit := uint(0)
-		if testutils.RandomBool(rng) {
-			bit = uint(1)
-		}
-		originBits.SetBit(originBits, i, bit)
-	}
-	var blockTxCounts []uint64
-	totalblockTxCounts := uint64(0)
-	for i := 0; i < int(blockCount); i++ {
-		blockTxCount := 1 + uint64(rng.Intn(16))
-		blockTxCounts = append(blockTxCounts, blockTxCount)
-		totalblockTxCounts += blockTxCount
-	}
-	londonSigner := types.NewLondonSigner(chainId)
-	var txs [][]byte
-	for i := 0; i < int(totalblockTxCounts); i++ {
-		var tx *types.Transaction
-		switch i % 4 {
-		case 0:
-			tx = testutils.RandomLegacyTx(rng, types.HomesteadSigner{})
-		case 1:
-			tx = testutils.RandomLegacyTx(rng, londonSigner)
-		case 2:
-			tx = testutils.RandomAccessListTx(rng, londonSigner)
-		case 3:
-			tx = testutils.RandomDynamicFeeTx(rng, londonSigner)
-		}
-		rawTx, err := tx.MarshalBinary()
-		if err != nil {
-			panic("MarshalBinary:" + err.Error())
-		}
-		txs = append(txs, rawTx)
-	}
-	spanBatchTxs, err := newSpanBatchTxs(txs, chainId)
-	if err != nil {
-		panic(err.Error())
-	}
-	rawSpanBatch := RawSpanBatch{
-		spanBatchPrefix: spanBatchPrefix{
-			relTimestamp:  uint64(rng.Uint32()),
-			l1OriginNum:   rng.Uint64(),
-			parentCheck:   [20]byte(testutils.RandomData(rng, 20)),
-			l1OriginCheck: [20]byte(testutils.RandomData(rng, 20)),
-		},
-		spanBatchPayload: spanBatchPayload{
-			blockCount:    blockCount,
-			originBits:    originBits,
-			blockTxCounts: blockTxCounts,
-			txs:           spanBatchTxs,
-		},
-	}
-	return &rawSpanBatch
-}
-
 func RandomValidConsecutiveSingularBatches(rng *rand.Rand, chainID *big.Int) []*SingularBatch {
 	blockCount := 2 + rng.Intn(128)
 	l2BlockTime := uint64(2)
@@ -1,6 +1,7 @@
 package derive
 
 import (
+	"fmt"
 	"math/big"
 	"math/rand"
 
@@ -8,6 +9,7 @@ import (
 	"github.com/ethereum-optimism/optimism/op-service/testutils"
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rlp"
 )
 
 func RandomSingularBatch(rng *rand.Rand, txCount int, chainID *big.Int) *SingularBatch {
@@ -31,3 +33,120 @@ func RandomSingularBatch(rng *rand.Rand, txCount int, chainID *big.Int) *Singula
 		Transactions: txsEncoded,
 	}
 }
+
+func RandomRawSpanBatch(rng *rand.Rand, chainId *big.Int) *RawSpanBatch {
+	blockCount := uint64(4 + rng.Int()&0xFF) // at least 4
+	originBits := new(big.Int)
+	for i := 0; i < int(blockCount); i++ {
+		bit := uint(0)
+		if testutils.RandomBool(rng) {
+			bit = uint(1)
+		}
+		originBits.SetBit(originBits, i, bit)
+	}
+	var blockTxCounts []uint64
+	totalblockTxCounts := uint64(0)
+	for i := 0; i < int(blockCount); i++ {
+		blockTxCount := 1 + uint64(rng.Intn(16))
+		blockTxCounts = append(blockTxCounts, blockTxCount)
+		totalblockTxCounts += blockTxCount
+	}
+	londonSigner := types.NewLondonSigner(chainId)
+	var txs [][]byte
+	for i := 0; i < int(totalblockTxCounts); i++ {
+		var tx *types.Transaction
+		switch i % 4 {
+		case 0:
+			tx = testutils.RandomLegacyTx(rng, types.HomesteadSigner{})
+		case 1:
+			tx = testutils.RandomLegacyTx(rng, londonSigner)
+		case 2:
+			tx = testutils.RandomAccessListTx(rng, londonSigner)
+		case 3:
+			tx = testutils.RandomDynamicFeeTx(rng, londonSigner)
+		}
+		rawTx, err := tx.MarshalBinary()
+		if err != nil {
+			panic("MarshalBinary:" + err.Error())
+		}
+		txs = append(txs, rawTx)
+	}
+	spanBatchTxs, err := newSpanBatchTxs(txs, chainId)
+	if err != nil {
+		panic(err.Error())
+	}
+	rawSpanBatch := RawSpanBatch{
+		spanBatchPrefix: spanBatchPrefix{
+			relTimestamp:  uint64(rng.Uint32()),
+			l1OriginNum:   rng.Uint64(),
+			parentCheck:   [20]byte(testutils.RandomData(rng, 20)),
+			l1OriginCheck: [20]byte(testutils.RandomData(rng, 20)),
+		},
+		spanBatchPayload: spanBatchPayload{
+			blockCount:    blockCount,
+			originBits:    originBits,
+			blockTxCounts: blockTxCounts,
+			txs:           spanBatchTxs,
+		},
+	}
+	return &rawSpanBatch
+}
+
+// channelSpanBatchBlocks is the number of blocks of the span batches of RandomChannelBatches.
+const channelSpanBatchBlocks = 4
+
+// RandomChannelBatches returns count random batches of the given batch type, for channel
+// encoding tests and benchmarks. Singular batches contain txCount transactions each, while
+// span batches contain a few blocks of txCount transactions each.
+func RandomChannelBatches(rng *rand.Rand, batchType int, count int, txCount int, chainID *big.Int) ([]*BatchData, error) {
+	batches := make([]*BatchData, 0, count)
+	for i := 0; i < count; i++ {
+		switch batchType {
+		case SingularBatchType:
+			batches = append(batches, NewBatchData(RandomSingularBatch(rng, txCount, chainID)))
+		case SpanBatchType:
+			spanBatch, err := randomChannelSpanBatch(rng, txCount, chainID)
+			if err != nil {
+				return nil, err
+			}
+			batches = append(batches, NewBatchData(spanBatch))
+		default:
+			return nil, fmt.Errorf("unrecognized batch type: %d", batchType)
+		}
+	}
+	return batches, nil
+}
+
+// randomChannelSpanBatch returns a span batch of channelSpanBatchBlocks consecutive blocks,
+// with txCount transactions each.
+func randomChannelSpanBatch(rng *rand.Rand, txCount int, chainID *big.Int) (*RawSpanBatch, error) {
+	spanBatch := NewSpanBatch(0, chainID)
+	timestamp := uint64(rng.Int63n(2_000_000_000))
+	for i := 0; i < channelSpanBatchBlocks; i++ {
+		batch := RandomSingularBatch(rng, txCount, chainID)
+		batch.Timestamp = timestamp + uint64(i)
+		if err := spanBatch.AppendSingularBatch(batch, uint64(i)); err != nil {
+			return nil, err
+		}
+	}
+	return spanBatch.ToRawSpanBatch()
+}
+
+// ChannelData RLP-encodes the batches back to back and compresses them with the given
+// algorithm, the same way the batcher builds channel data. The result can be decoded with
+// BatchReader, or written to a ChannelInReader.
+func ChannelData(algo CompressionAlgo, batches ...*BatchData) ([]byte, error) {
+	compressor, err := NewChannelCompressor(algo)
+	if err != nil {
+		return nil, err
+	}
+	for i, batch := range batches {
+		if err := rlp.Encode(compressor, batch); err != nil {
+			return nil, fmt.Errorf("failed to encode batch %d: %w", i, err)
+		}
+	}
+	if err := compressor.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close compressor: %w", err)
+	}
+	return compressor.GetCompressed().Bytes(), nil
+}
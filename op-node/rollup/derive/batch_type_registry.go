@@ -0,0 +1,118 @@
+package derive
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CustomBatch is a batch of a custom batch type, decoded by a decoder registered with a
+// BatchTypeRegistry. Custom batches are wrapped in a BatchData, see NewCustomBatchData and
+// AsCustomBatch.
+type CustomBatch interface {
+	// BatchType returns the batch type, which precedes the payload in the batch encoding.
+	BatchType() uint8
+	// MarshalBinary returns the payload of the batch, without the batch type.
+	MarshalBinary() ([]byte, error)
+}
+
+// CustomBatchDecoder decodes the payload of a custom batch, which follows the batch type.
+type CustomBatchDecoder func(payload []byte) (CustomBatch, error)
+
+// batchDecoder decodes the payload of a batch into its inner batch data.
+type batchDecoder func(payload []byte) (InnerBatchData, error)
+
+// BatchTypeRegistry maps batch types to the decoders of the batch types.
+// It allows the batch reader to decode custom batch types, see WithBatchTypeRegistry.
+type BatchTypeRegistry struct {
+	decoders map[uint8]batchDecoder
+}
+
+// NewBatchTypeRegistry creates a BatchTypeRegistry with the built-in batch types registered.
+func NewBatchTypeRegistry() *BatchTypeRegistry {
+	reg := &BatchTypeRegistry{decoders: make(map[uint8]batchDecoder)}
+	reg.decoders[SingularBatchType] = func(payload []byte) (InnerBatchData, error) {
+		batch := new(SingularBatch)
+		return batch, batch.decode(bytes.NewReader(payload))
+	}
+	reg.decoders[SpanBatchType] = func(payload []byte) (InnerBatchData, error) {
+		batch := new(RawSpanBatch)
+		return batch, batch.decode(bytes.NewReader(payload))
+	}
+	return reg
+}
+
+// Register registers the decoder of a custom batch type.
+// It returns an error if the batch type is already registered, or reserved for channel
+// footers or attestations.
+func (reg *BatchTypeRegistry) Register(batchType uint8, decoder CustomBatchDecoder) error {
+	if batchType == ChannelFooterType || batchType == ChannelAttestationType {
+		return fmt.Errorf("batch type %d is reserved", batchType)
+	}
+	if _, ok := reg.decoders[batchType]; ok {
+		return fmt.Errorf("batch type %d already registered", batchType)
+	}
+	reg.decoders[batchType] = func(payload []byte) (InnerBatchData, error) {
+		batch, err := decoder(payload)
+		if err != nil {
+			return nil, err
+		}
+		if batch.BatchType() != batchType {
+			return nil, fmt.Errorf("decoder of batch type %d returned batch of type %d", batchType, batch.BatchType())
+		}
+		return customBatchData{batch}, nil
+	}
+	return nil
+}
+
+// decode decodes the typed batch data into batchData, like BatchData.UnmarshalBinary,
+// but with the registered batch types.
+func (reg *BatchTypeRegistry) decode(batchData *BatchData, data []byte) error {
+	if len(data) == 0 {
+		return errors.New("batch too short")
+	}
+	decoder, ok := reg.decoders[data[0]]
+	if !ok {
+		return fmt.Errorf("unrecognized batch type: %d", data[0])
+	}
+	inner, err := decoder(data[1:])
+	if err != nil {
+		return err
+	}
+	batchData.inner = inner
+	return nil
+}
+
+// NewCustomBatchData creates a new BatchData of a custom batch, e.g. to encode it.
+func NewCustomBatchData(batch CustomBatch) *BatchData {
+	return NewBatchData(customBatchData{batch})
+}
+
+// AsCustomBatch returns the custom batch of the batch data, and whether it is a custom batch.
+func AsCustomBatch(batchData *BatchData) (CustomBatch, bool) {
+	custom, ok := batchData.inner.(customBatchData)
+	return custom.CustomBatch, ok
+}
+
+// customBatchData adapts a CustomBatch to InnerBatchData.
+type customBatchData struct {
+	CustomBatch
+}
+
+func (b customBatchData) GetBatchType() int {
+	return int(b.BatchType())
+}
+
+func (b customBatchData) encode(w io.Writer) error {
+	payload, err := b.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(payload)
+	return err
+}
+
+func (b customBatchData) decode(*bytes.Reader) error {
+	return errors.New("custom batches are decoded by their BatchTypeRegistry")
+}
@@ -0,0 +1,112 @@
+package derive_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/rollup/derive"
+)
+
+const testCustomBatchType = 0x7e
+
+// testCustomBatch is a custom batch type, with an opaque payload.
+type testCustomBatch struct {
+	Payload []byte
+}
+
+func (b *testCustomBatch) BatchType() uint8 {
+	return testCustomBatchType
+}
+
+func (b *testCustomBatch) MarshalBinary() ([]byte, error) {
+	return b.Payload, nil
+}
+
+func decodeTestCustomBatch(payload []byte) (derive.CustomBatch, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("empty custom batch")
+	}
+	return &testCustomBatch{Payload: payload}, nil
+}
+
+func TestBatchTypeRegistry(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x195))
+	chainID := big.NewInt(333)
+	batches := []*derive.BatchData{
+		derive.NewBatchData(derive.RandomSingularBatch(rng, 2, chainID)),
+		derive.NewCustomBatchData(&testCustomBatch{Payload: []byte("custom")}),
+		derive.NewBatchData(derive.RandomSingularBatch(rng, 3, chainID)),
+	}
+	channel, err := derive.ChannelData(derive.Zlib, batches...)
+	require.NoError(t, err)
+
+	readAll := func(reg *derive.BatchTypeRegistry) ([]*derive.BatchData, error) {
+		reader, err := derive.BatchReader(bytes.NewReader(channel), 10_000_000, false, derive.WithBatchTypeRegistry(reg))
+		require.NoError(t, err)
+		var decoded []*derive.BatchData
+		for {
+			batch, err := reader()
+			if err == io.EOF {
+				return decoded, nil
+			} else if err != nil {
+				return decoded, err
+			}
+			decoded = append(decoded, batch)
+		}
+	}
+
+	t.Run("custom-type", func(t *testing.T) {
+		reg := derive.NewBatchTypeRegistry()
+		require.NoError(t, reg.Register(testCustomBatchType, decodeTestCustomBatch))
+		decoded, err := readAll(reg)
+		require.NoError(t, err)
+		require.Len(t, decoded, len(batches))
+		for i, batch := range batches {
+			require.Equal(t, batch.GetBatchType(), decoded[i].GetBatchType())
+			expected, err := batch.MarshalBinary()
+			require.NoError(t, err)
+			actual, err := decoded[i].MarshalBinary()
+			require.NoError(t, err)
+			require.Equal(t, expected, actual)
+		}
+		custom, ok := derive.AsCustomBatch(decoded[1])
+		require.True(t, ok)
+		require.Equal(t, &testCustomBatch{Payload: []byte("custom")}, custom)
+		_, ok = derive.AsCustomBatch(decoded[0])
+		require.False(t, ok)
+	})
+
+	t.Run("unregistered-type", func(t *testing.T) {
+		decoded, err := readAll(derive.NewBatchTypeRegistry())
+		require.ErrorContains(t, err, "unrecognized batch type")
+		require.Len(t, decoded, 1)
+	})
+
+	t.Run("decoder-error", func(t *testing.T) {
+		reg := derive.NewBatchTypeRegistry()
+		require.NoError(t, reg.Register(testCustomBatchType, func(payload []byte) (derive.CustomBatch, error) {
+			return nil, errors.New("invalid custom batch")
+		}))
+		_, err := readAll(reg)
+		require.ErrorContains(t, err, "invalid custom batch")
+	})
+
+	t.Run("duplicate-type", func(t *testing.T) {
+		reg := derive.NewBatchTypeRegistry()
+		require.Error(t, reg.Register(derive.SingularBatchType, decodeTestCustomBatch))
+		require.NoError(t, reg.Register(testCustomBatchType, decodeTestCustomBatch))
+		require.Error(t, reg.Register(testCustomBatchType, decodeTestCustomBatch))
+	})
+
+	t.Run("reserved-type", func(t *testing.T) {
+		reg := derive.NewBatchTypeRegistry()
+		require.Error(t, reg.Register(derive.ChannelFooterType, decodeTestCustomBatch))
+		require.Error(t, reg.Register(derive.ChannelAttestationType, decodeTestCustomBatch))
+	})
+}
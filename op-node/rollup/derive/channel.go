@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"compress/zlib"
+	"encoding/binary"
 	"fmt"
+	"hash/crc32"
 	"io"
 
 	"github.com/andybalholm/brotli"
@@ -43,6 +45,12 @@ type Channel struct {
 	inputs map[uint64]Frame
 
 	highestL1InclusionBlock eth.L1BlockRef
+
+	// maxFrames limits the number of frames of the channel. Zero means no limit.
+	maxFrames uint64
+
+	// frameCRCs enables validation and stripping of the CRC trailing the data of each frame.
+	frameCRCs bool
 }
 
 func NewChannel(id ChannelID, openBlock eth.L1BlockRef) *Channel {
@@ -53,6 +61,22 @@ func NewChannel(id ChannelID, openBlock eth.L1BlockRef) *Channel {
 	}
 }
 
+// SetMaxFrames limits the number of frames of the channel, to protect callers assembling
+// channels from frames against channels fragmented into excessive numbers of frames.
+// Frames with a frame number at or above the limit are rejected by AddFrame with
+// ErrTooManyFrames. A limit of zero, the default, disables the check, as in the derivation pipeline.
+func (ch *Channel) SetMaxFrames(maxFrames uint64) {
+	ch.maxFrames = maxFrames
+}
+
+// SetFrameCRCs enables per-frame CRCs, as used by an integrity-enhanced channel format.
+// The data of each frame then ends with the big-endian CRC-32 (IEEE) of the preceding frame data.
+// AddFrame rejects frames with a mismatching or missing CRC with ErrFrameCRCMismatch, and strips
+// the CRC of valid frames, so the assembled channel data is the same as without CRCs.
+func (ch *Channel) SetFrameCRCs(enabled bool) {
+	ch.frameCRCs = enabled
+}
+
 // AddFrame adds a frame to the channel.
 // If the frame is not valid for the channel it returns an error.
 // Otherwise the frame is buffered.
@@ -67,9 +91,19 @@ func (ch *Channel) AddFrame(frame Frame, l1InclusionBlock eth.L1BlockRef) error
 	if _, ok := ch.inputs[uint64(frame.FrameNumber)]; ok {
 		return DuplicateErr
 	}
+	if ch.maxFrames != 0 && uint64(frame.FrameNumber) >= ch.maxFrames {
+		return fmt.Errorf("%w: frame number %d, limit %d frames", ErrTooManyFrames, frame.FrameNumber, ch.maxFrames)
+	}
 	if ch.closed && frame.FrameNumber >= ch.endFrameNumber {
 		return fmt.Errorf("frame number (%d) is greater than or equal to end frame number (%d) of a closed channel", frame.FrameNumber, ch.endFrameNumber)
 	}
+	if ch.frameCRCs {
+		data, err := stripFrameCRC(frame.Data)
+		if err != nil {
+			return fmt.Errorf("frame %d: %w", frame.FrameNumber, err)
+		}
+		frame.Data = data
+	}
 
 	// Guaranteed to succeed. Now update internal state
 	if frame.IsLast {
@@ -101,6 +135,19 @@ func (ch *Channel) AddFrame(frame Frame, l1InclusionBlock eth.L1BlockRef) error
 	return nil
 }
 
+// stripFrameCRC validates the CRC trailing the frame data, and returns the data without it.
+func stripFrameCRC(data []byte) ([]byte, error) {
+	if len(data) < crc32.Size {
+		return nil, fmt.Errorf("%w: frame data too short for crc", ErrFrameCRCMismatch)
+	}
+	n := len(data) - crc32.Size
+	expected := binary.BigEndian.Uint32(data[n:])
+	if actual := crc32.ChecksumIEEE(data[:n]); actual != expected {
+		return nil, fmt.Errorf("%w: expected %08x, got %08x", ErrFrameCRCMismatch, expected, actual)
+	}
+	return data[:n], nil
+}
+
 // OpenBlockNumber returns the block number of L1 block that contained
 // the first frame for this channel.
 func (ch *Channel) OpenBlockNumber() uint64 {
@@ -158,9 +205,41 @@ func (ch *Channel) Reader() io.Reader {
 // The L1Inclusion block is also provided at creation time.
 // Warning: the batch reader can read every batch-type.
 // The caller of the batch-reader should filter the results.
-func BatchReader(r io.Reader, maxRLPBytesPerChannel uint64, isFjord bool) (func() (*BatchData, error), error) {
+// Optional, non-canonical behavior can be enabled with BatchReaderOptions.
+func BatchReader(r io.Reader, maxRLPBytesPerChannel uint64, isFjord bool, opts ...BatchReaderOption) (func() (*BatchData, error), error) {
+	br, err := newBatchReader(r, maxRLPBytesPerChannel, isFjord, newBatchReaderConfig(opts))
+	if err != nil {
+		return nil, err
+	}
+	return br.readBatch, nil
+}
+
+// newBatchReader detects the compression algo of the channel data and sets up the
+// decompressor stage and RLP reader of a batchReader.
+func newBatchReader(r io.Reader, maxRLPBytesPerChannel uint64, isFjord bool, cfg *batchReaderConfig) (*batchReader, error) {
+	if cfg.footer && cfg.attestation {
+		return nil, fmt.Errorf("%w: attestations can't be combined with channel footers", ErrChannelAttestation)
+	}
 	// use buffered reader so can peek the first byte
 	bufReader := bufio.NewReader(r)
+	lengthPrefixed := cfg.lengthPrefixed
+	if cfg.containers {
+		container, containerLengthPrefixed, err := readContainerHeader(bufReader)
+		if err != nil {
+			return nil, err
+		}
+		if container {
+			lengthPrefixed = containerLengthPrefixed
+		}
+	}
+	var sizeHint uint64
+	if cfg.sizeHint {
+		hint, err := binary.ReadUvarint(bufReader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read uncompressed size hint: %w", err)
+		}
+		sizeHint = hint
+	}
 	compressionType, err := bufReader.Peek(1)
 	if err != nil {
 		return nil, err
@@ -189,18 +268,54 @@ func BatchReader(r io.Reader, maxRLPBytesPerChannel uint64, isFjord bool) (func(
 		}
 		zr = brotli.NewReader(bufReader)
 		comprAlgo = Brotli
+	} else if compressionType[0] == ChannelVersionUncompressed && cfg.uncompressed {
+		// discard the version byte, the rest is the raw RLP batch stream
+		if _, err := bufReader.Discard(1); err != nil {
+			return nil, err
+		}
+		zr = bufReader
 	} else {
 		return nil, fmt.Errorf("cannot distinguish the compression algo used given type byte %v", compressionType[0])
 	}
 
+	if cfg.sizeHint {
+		// The RLP reader isn't limited to the size hint, as it would end the channel
+		// silently at the limit, instead of failing on excess data.
+		zr = &sizeLimitReader{r: zr, remaining: sizeHint}
+	}
+
 	// Setup decompressor stage + RLP reader
-	rlpReader := rlp.NewStream(zr, maxRLPBytesPerChannel)
-	// Read each batch iteratively
-	return func() (*BatchData, error) {
-		batchData := BatchData{ComprAlgo: comprAlgo}
-		if err := rlpReader.Decode(&batchData); err != nil {
+	br := &batchReader{
+		cfg:          cfg,
+		comprAlgo:    comprAlgo,
+		decompressed: &countingReader{r: zr},
+	}
+	zr = br.decompressed
+	var buffered *bufio.Reader
+	if size := cfg.bufferSize(sizeHint); size != 0 {
+		buffered = bufio.NewReaderSize(zr, size)
+		zr = buffered
+	}
+	if lengthPrefixed {
+		if buffered == nil {
+			buffered = bufio.NewReader(zr)
+		}
+		// The RLP reader doesn't read ahead of the items it decodes from a buffered reader,
+		// so it can share the reader with the framed batches.
+		br.framed = buffered
+		br.framedBudget = maxRLPBytesPerChannel
+		zr = br.framed
+	}
+	br.rlp = rlp.NewStream(zr, maxRLPBytesPerChannel)
+	if cfg.chainID != nil {
+		if err := br.readChainID(); err != nil {
 			return nil, err
 		}
-		return &batchData, nil
-	}, nil
+	}
+	if cfg.frameCountPrefix {
+		if err := br.readFrameCount(); err != nil {
+			return nil, err
+		}
+	}
+	return br, nil
 }
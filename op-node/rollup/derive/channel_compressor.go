@@ -11,6 +11,10 @@ import (
 
 const (
 	ChannelVersionBrotli byte = 0x01
+	// ChannelVersionUncompressed marks an experimental, debug-only channel format that carries the
+	// RLP batch stream without compression. It is only accepted by batch readers created with
+	// WithUncompressedChannels.
+	ChannelVersionUncompressed byte = 0xf0
 )
 
 type ChannelCompressor interface {
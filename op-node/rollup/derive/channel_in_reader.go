@@ -3,9 +3,11 @@ package derive
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
 
 	"github.com/ethereum-optimism/optimism/op-node/rollup"
@@ -17,35 +19,83 @@ import (
 // This is a pure function from the channel, but each channel (or channel fragment)
 // must be tagged with an L1 inclusion block to be passed to the batch queue.
 type ChannelInReader struct {
-	log         log.Logger
-	spec        *rollup.ChainSpec
-	cfg         *rollup.Config
-	nextBatchFn func() (*BatchData, error)
-	prev        *ChannelBank
-	metrics     Metrics
+	log       log.Logger
+	spec      *rollup.ChainSpec
+	cfg       *rollup.Config
+	reader    *batchReader
+	readerCfg *batchReaderConfig
+	// data and dataOrigin are the current channel and the origin it was written at,
+	// kept to be able to decode the channel again from the start.
+	data       []byte
+	dataOrigin eth.L1BlockRef
+	prev       *ChannelBank
+	metrics    Metrics
+	stats      ChannelInReaderStats
+
+	// chunks buffers the channel data written with WriteChannelChunk, until chunksTotal is reached.
+	chunks      []byte
+	chunksTotal uint64
+	chunking    bool
+
+	// channelCapacity is the expected maximum size of compressed channel data. Zero means no limit.
+	channelCapacity uint64
+	// strictCapacity rejects channels exceeding channelCapacity, instead of only warning.
+	strictCapacity bool
+}
+
+// ChannelInReaderStats are lifecycle counters of a ChannelInReader.
+// They help to detect pipeline loops that keep resetting the reader.
+type ChannelInReaderStats struct {
+	// Resets is the number of times Reset was called.
+	Resets uint64
+	// NextChannels is the number of times the current channel was dropped with NextChannel.
+	// This includes the calls made by Reset and after a channel is drained or fails to decode.
+	NextChannels uint64
 }
 
 var _ ResettableStage = (*ChannelInReader)(nil)
 
 // NewChannelInReader creates a ChannelInReader, which should be Reset(origin) before use.
-func NewChannelInReader(cfg *rollup.Config, log log.Logger, prev *ChannelBank, metrics Metrics) *ChannelInReader {
+// The optional BatchReaderOptions are applied to the batch reader of every channel.
+func NewChannelInReader(cfg *rollup.Config, log log.Logger, prev *ChannelBank, metrics Metrics, opts ...BatchReaderOption) *ChannelInReader {
 	return &ChannelInReader{
-		spec:    rollup.NewChainSpec(cfg),
-		cfg:     cfg,
-		log:     log,
-		prev:    prev,
-		metrics: metrics,
+		spec:      rollup.NewChainSpec(cfg),
+		cfg:       cfg,
+		log:       log,
+		prev:      prev,
+		metrics:   metrics,
+		readerCfg: newBatchReaderConfig(opts),
 	}
 }
 
+// SetChannelCapacity sets the maximum expected size of compressed channel data, e.g. the data
+// capacity of the transactions the batcher is configured to send. Channels exceeding it point
+// to misconfiguration or an attack. In strict mode WriteChannel rejects such channels with
+// ErrChannelTooLarge, otherwise only a warning is logged. A capacity of zero, the default,
+// disables the check.
+func (cr *ChannelInReader) SetChannelCapacity(capacity uint64, strict bool) {
+	cr.channelCapacity = capacity
+	cr.strictCapacity = strict
+}
+
 func (cr *ChannelInReader) Origin() eth.L1BlockRef {
 	return cr.prev.Origin()
 }
 
 // TODO: Take full channel for better logging
 func (cr *ChannelInReader) WriteChannel(data []byte) error {
-	if f, err := BatchReader(bytes.NewBuffer(data), cr.spec.MaxRLPBytesPerChannel(cr.prev.Origin().Time), cr.cfg.IsFjord(cr.prev.Origin().Time)); err == nil {
-		cr.nextBatchFn = f
+	if capacity := cr.channelCapacity; capacity != 0 && uint64(len(data)) > capacity {
+		if cr.strictCapacity {
+			cr.log.Error("Rejecting channel data exceeding capacity", "size", len(data), "capacity", capacity)
+			return fmt.Errorf("%w: size %d, capacity %d", ErrChannelTooLarge, len(data), capacity)
+		}
+		cr.log.Warn("Channel data exceeds capacity", "size", len(data), "capacity", capacity)
+	}
+	origin := cr.prev.Origin()
+	if br, err := cr.newBatchReader(data, origin, cr.readerCfg); err == nil {
+		cr.reader = br
+		cr.data = data
+		cr.dataOrigin = origin
 		cr.metrics.RecordChannelInputBytes(len(data))
 		return nil
 	} else {
@@ -54,17 +104,202 @@ func (cr *ChannelInReader) WriteChannel(data []byte) error {
 	}
 }
 
+// WriteChannelChunk buffers a chunk of channel data, for sources that reconstruct channels
+// progressively and know the total length of the channel upfront. Once the buffered chunks
+// reach the total length, they are written with WriteChannel and ready is true, unless
+// WriteChannel fails, in which case its error is returned.
+// All chunks of a channel must declare the same total, and may not exceed it. Otherwise the
+// buffered chunks are dropped and ErrChannelLengthMismatch is returned.
+func (cr *ChannelInReader) WriteChannelChunk(chunk []byte, total uint64) (ready bool, err error) {
+	if cr.chunking && total != cr.chunksTotal {
+		cr.dropChunks()
+		return false, fmt.Errorf("%w: chunk declares total %d, expected %d", ErrChannelLengthMismatch, total, cr.chunksTotal)
+	}
+	if size := uint64(len(cr.chunks) + len(chunk)); size > total {
+		cr.dropChunks()
+		return false, fmt.Errorf("%w: chunks add up to %d bytes, declared total %d", ErrChannelLengthMismatch, size, total)
+	}
+	cr.chunking = true
+	cr.chunksTotal = total
+	cr.chunks = append(cr.chunks, chunk...)
+	if uint64(len(cr.chunks)) < total {
+		return false, nil
+	}
+	data := cr.chunks
+	cr.dropChunks()
+	if err := cr.WriteChannel(data); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// dropChunks drops the channel chunks buffered by WriteChannelChunk.
+func (cr *ChannelInReader) dropChunks() {
+	cr.chunks = nil
+	cr.chunksTotal = 0
+	cr.chunking = false
+}
+
+// recordCompressionRatio records the ratio of decompressed to compressed bytes of the
+// current channel, once it is drained.
+func (cr *ChannelInReader) recordCompressionRatio() {
+	if len(cr.data) == 0 {
+		return
+	}
+	cr.metrics.RecordChannelCompressionRatio(float64(cr.reader.decompressed.n) / float64(len(cr.data)))
+}
+
 // NextChannel forces the next read to continue with the next channel,
 // resetting any decoding/decompression state to a fresh start.
 func (cr *ChannelInReader) NextChannel() {
-	cr.nextBatchFn = nil
+	cr.stats.NextChannels++
+	cr.reader = nil
+	cr.data = nil
+}
+
+// newBatchReader creates a batch reader for channel data written at the given L1 origin.
+func (cr *ChannelInReader) newBatchReader(data []byte, origin eth.L1BlockRef, readerCfg *batchReaderConfig) (*batchReader, error) {
+	return newBatchReader(bytes.NewReader(data), cr.spec.MaxRLPBytesPerChannel(origin.Time), cr.cfg.IsFjord(origin.Time), readerCfg)
+}
+
+// FirstBatch decodes and returns the first batch of the current channel, e.g. to identify
+// the channel, without draining the channel. The read position of the current channel is
+// unchanged. It returns io.EOF if there is no current channel or the channel has no batches.
+func (cr *ChannelInReader) FirstBatch() (*BatchData, error) {
+	if cr.reader == nil {
+		return nil, io.EOF
+	}
+	br, err := cr.newBatchReader(cr.data, cr.dataOrigin, cr.reader.cfg.quiet())
+	if err != nil {
+		return nil, err
+	}
+	return br.readBatch()
+}
+
+// CountRemainingBatches returns the number of batches that can still be read from the
+// current channel, without advancing the current channel.
+// This is expensive: the whole channel is decompressed and decoded again from the start.
+// If the channel fails to decode, the batches counted up to the failure are returned
+// together with the error.
+func (cr *ChannelInReader) CountRemainingBatches() (int, error) {
+	if cr.reader == nil {
+		return 0, nil
+	}
+	br, err := cr.newBatchReader(cr.data, cr.dataOrigin, cr.reader.cfg.quiet())
+	if err != nil {
+		return 0, err
+	}
+	for {
+		if _, err := br.readBatch(); err == io.EOF {
+			return br.index - cr.reader.index, nil
+		} else if err != nil {
+			return max(br.index-cr.reader.index, 0), err
+		}
+	}
+}
+
+// Validate drains the current channel, discarding the decoded batches, and returns the first
+// decoding error, or nil if the rest of the channel decodes fine. The channel is dropped
+// afterwards, like a channel drained with NextBatch. Validate returns nil if there is no
+// current channel.
+func (cr *ChannelInReader) Validate() error {
+	return cr.Drain(nil)
+}
+
+// RewindBatch rewinds the current channel by one batch, so that the next read returns the
+// last batch read again, e.g. for lookahead parsing. Only a single batch can be rewound.
+// A rewound batch is also returned by ReadInto, decoded from its canonical encoding.
+// It returns ErrNothingToRewind if there is no current channel, no batch has been read yet,
+// or the last read failed.
+func (cr *ChannelInReader) RewindBatch() error {
+	if cr.reader == nil {
+		return ErrNothingToRewind
+	}
+	return cr.reader.rewind()
+}
+
+// Drain drains the current channel like Validate, and calls onBatch with each decoded batch
+// in channel order, if not nil. This allows streaming processing of the batches of a channel,
+// without collecting them first.
+func (cr *ChannelInReader) Drain(onBatch func(batch *BatchData)) error {
+	if cr.reader == nil {
+		return nil
+	}
+	defer cr.NextChannel()
+	for {
+		batch, err := cr.reader.readBatch()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if onBatch != nil {
+			onBatch(batch)
+		}
+	}
+}
+
+// ReadInto RLP-decodes the next item of the current channel into dest, which can be any
+// RLP-compatible value, for tools reading channels with custom contents. Batch decoding and
+// checks are bypassed. It returns io.EOF if there is no current channel, or all of its items
+// have been read.
+func (cr *ChannelInReader) ReadInto(dest any) error {
+	if cr.reader == nil {
+		return io.EOF
+	}
+	return cr.reader.readInto(dest)
+}
+
+// Stats returns a snapshot of the lifecycle counters of the reader.
+func (cr *ChannelInReader) Stats() ChannelInReaderStats {
+	return cr.stats
+}
+
+// FrameCount returns the frame count declared by the prefix of the current channel.
+// It returns false if there is no current channel, or if frame count prefixes are not
+// enabled with WithFrameCountPrefix.
+func (cr *ChannelInReader) FrameCount() (uint64, bool) {
+	if cr.reader == nil || !cr.readerCfg.frameCountPrefix {
+		return 0, false
+	}
+	return cr.reader.frameCount, true
+}
+
+// SetBatchChecksums sets the expected checksums of the batches of the current channel, like
+// WithBatchChecksums does for a single channel. The checksums are indexed from the first batch
+// of the channel, and don't apply to later channels.
+// It returns an error if there is no current channel.
+func (cr *ChannelInReader) SetBatchChecksums(checksums []common.Hash) error {
+	if cr.reader == nil {
+		return errors.New("no current channel to set batch checksums for")
+	}
+	cfg := *cr.reader.cfg
+	cfg.checksums = checksums
+	cr.reader.cfg = &cfg
+	return nil
+}
+
+// ValidateFrameCount checks the frame count declared by the prefix of the current channel
+// against the number of frames the caller assembled the channel from. This validates the prefix
+// per channel, unlike the fixed frame count passed to WithFrameCountPrefix.
+// On a mismatch, the channel is dropped and an ErrFrameCountMismatch error is returned.
+func (cr *ChannelInReader) ValidateFrameCount(assembledFrames uint64) error {
+	count, ok := cr.FrameCount()
+	if !ok {
+		return errors.New("no frame count prefix to validate")
+	}
+	if count != assembledFrames {
+		cr.NextChannel()
+		return fmt.Errorf("%w: prefix declares %d frames, assembled %d", ErrFrameCountMismatch, count, assembledFrames)
+	}
+	return nil
 }
 
 // NextBatch pulls out the next batch from the channel if it has it.
 // It returns io.EOF when it cannot make any more progress.
 // It will return a temporary error if it needs to be called again to advance some internal state.
 func (cr *ChannelInReader) NextBatch(ctx context.Context) (Batch, error) {
-	if cr.nextBatchFn == nil {
+	if cr.reader == nil {
 		if data, err := cr.prev.NextData(ctx); err == io.EOF {
 			return nil, io.EOF
 		} else if err != nil {
@@ -78,8 +313,13 @@ func (cr *ChannelInReader) NextBatch(ctx context.Context) (Batch, error) {
 
 	// TODO: can batch be non nil while err == io.EOF
 	// This depends on the behavior of rlp.Stream
-	batchData, err := cr.nextBatchFn()
+	batchData, err := cr.reader.readBatch()
 	if err == io.EOF {
+		cr.recordCompressionRatio()
+		cr.NextChannel()
+		return nil, NotEnoughData
+	} else if errors.Is(err, ErrTruncatedChannel) {
+		cr.log.Warn("channel data is truncated, skipping to next channel now", "err", err)
 		cr.NextChannel()
 		return nil, NotEnoughData
 	} else if err != nil {
@@ -119,6 +359,8 @@ func (cr *ChannelInReader) NextBatch(ctx context.Context) (Batch, error) {
 }
 
 func (cr *ChannelInReader) Reset(ctx context.Context, _ eth.L1BlockRef, _ eth.SystemConfig) error {
-	cr.nextBatchFn = nil
+	cr.stats.Resets++
+	cr.dropChunks()
+	cr.NextChannel()
 	return io.EOF
 }
@@ -0,0 +1,807 @@
+package derive
+
+import (
+	"context"
+	"io"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/rlp"
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum-optimism/optimism/op-node/metrics"
+	"github.com/ethereum-optimism/optimism/op-node/rollup"
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum-optimism/optimism/op-service/testlog"
+	"github.com/ethereum-optimism/optimism/op-service/testutils"
+)
+
+// eofFrameProvider is a NextFrameProvider that never has any frames.
+type eofFrameProvider struct {
+	origin eth.L1BlockRef
+}
+
+func (p *eofFrameProvider) Origin() eth.L1BlockRef {
+	return p.origin
+}
+
+func (p *eofFrameProvider) NextFrame(_ context.Context) (Frame, error) {
+	return Frame{}, io.EOF
+}
+
+var _ NextFrameProvider = (*eofFrameProvider)(nil)
+
+func newTestChannelInReader(t *testing.T, opts ...BatchReaderOption) *ChannelInReader {
+	cfg := &rollup.Config{ChannelTimeout: 10}
+	lgr := testlog.Logger(t, log.LevelCrit)
+	bank := NewChannelBank(lgr, cfg, &eofFrameProvider{}, nil, metrics.NoopMetrics)
+	return NewChannelInReader(cfg, lgr, bank, metrics.NoopMetrics, opts...)
+}
+
+func TestChannelInReaderNextChannelEOFNoAllocs(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x110))
+	cr := newTestChannelInReader(t)
+	require.NoError(t, cr.WriteChannel(compressBatches(t, NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))))))
+	cr.NextChannel()
+
+	ctx := context.Background()
+	_, err := cr.NextBatch(ctx)
+	require.ErrorIs(t, err, io.EOF)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := cr.NextBatch(ctx); err != io.EOF {
+			t.Fatalf("expected io.EOF, got %v", err)
+		}
+	})
+	require.Zero(t, allocs)
+}
+
+func TestChannelInReaderFrameCount(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x112))
+	batch := NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+
+	cr := newTestChannelInReader(t)
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batch)))
+	_, ok := cr.FrameCount()
+	require.False(t, ok, "frame count prefix not enabled")
+
+	cr = newTestChannelInReader(t, WithFrameCountPrefix(0))
+	_, ok = cr.FrameCount()
+	require.False(t, ok, "no current channel")
+	require.NoError(t, cr.WriteChannel(compressRLP(t, uint64(4), batch)))
+	count, ok := cr.FrameCount()
+	require.True(t, ok)
+	require.Equal(t, uint64(4), count)
+
+	cr.NextChannel()
+	_, ok = cr.FrameCount()
+	require.False(t, ok)
+}
+
+func TestChannelInReaderValidateFrameCount(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x112))
+	batch := NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+
+	cr := newTestChannelInReader(t)
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batch)))
+	require.Error(t, cr.ValidateFrameCount(1), "frame count prefix not enabled")
+
+	cr = newTestChannelInReader(t, WithFrameCountPrefix(0))
+	require.Error(t, cr.ValidateFrameCount(1), "no current channel")
+
+	// Channels assembled from different numbers of frames are validated individually.
+	require.NoError(t, cr.WriteChannel(compressRLP(t, uint64(2), batch)))
+	require.NoError(t, cr.ValidateFrameCount(2))
+	require.NoError(t, cr.Validate())
+	require.NoError(t, cr.WriteChannel(compressRLP(t, uint64(5), batch)))
+	require.NoError(t, cr.ValidateFrameCount(5))
+	cr.NextChannel()
+
+	require.NoError(t, cr.WriteChannel(compressRLP(t, uint64(3), batch)))
+	require.ErrorIs(t, cr.ValidateFrameCount(4), ErrFrameCountMismatch)
+	require.Nil(t, cr.reader, "channel dropped on mismatch")
+}
+
+func TestChannelInReaderStats(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x119))
+	batch := NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	ctx := context.Background()
+
+	cr := newTestChannelInReader(t)
+	require.Equal(t, ChannelInReaderStats{}, cr.Stats())
+
+	require.ErrorIs(t, cr.Reset(ctx, eth.L1BlockRef{}, eth.SystemConfig{}), io.EOF)
+	require.Equal(t, ChannelInReaderStats{Resets: 1, NextChannels: 1}, cr.Stats())
+
+	cr.NextChannel()
+	require.Equal(t, ChannelInReaderStats{Resets: 1, NextChannels: 2}, cr.Stats())
+
+	// Draining a channel moves on to the next channel.
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batch)))
+	_, err := cr.NextBatch(ctx)
+	require.NoError(t, err)
+	_, err = cr.NextBatch(ctx)
+	require.ErrorIs(t, err, NotEnoughData)
+	require.Equal(t, ChannelInReaderStats{Resets: 1, NextChannels: 3}, cr.Stats())
+
+	require.ErrorIs(t, cr.Reset(ctx, eth.L1BlockRef{}, eth.SystemConfig{}), io.EOF)
+	require.Equal(t, ChannelInReaderStats{Resets: 2, NextChannels: 4}, cr.Stats())
+}
+
+func TestChannelInReaderCountRemainingBatches(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x129))
+	batches := make([]*BatchData, 3)
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	}
+	ctx := context.Background()
+
+	cr := newTestChannelInReader(t)
+	count, err := cr.CountRemainingBatches()
+	require.NoError(t, err)
+	require.Zero(t, count, "no current channel")
+
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batches...)))
+	for i := range batches {
+		count, err := cr.CountRemainingBatches()
+		require.NoError(t, err)
+		require.Equal(t, len(batches)-i, count)
+
+		// Counting doesn't advance the channel.
+		batch, err := cr.NextBatch(ctx)
+		require.NoError(t, err)
+		singular, ok := batch.AsSingularBatch()
+		require.True(t, ok)
+		require.Equal(t, batches[i].inner, singular)
+	}
+	count, err = cr.CountRemainingBatches()
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	_, err = cr.NextBatch(ctx)
+	require.ErrorIs(t, err, NotEnoughData)
+}
+
+func TestChannelInReaderChannelCapacity(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x130))
+	data := compressBatches(t, NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))))
+	size := uint64(len(data))
+
+	newReader := func(t *testing.T, capacity uint64, strict bool) (*ChannelInReader, *testlog.CapturingHandler) {
+		cfg := &rollup.Config{ChannelTimeout: 10}
+		lgr, logs := testlog.CaptureLogger(t, log.LevelWarn)
+		bank := NewChannelBank(lgr, cfg, &eofFrameProvider{}, nil, metrics.NoopMetrics)
+		cr := NewChannelInReader(cfg, lgr, bank, metrics.NoopMetrics)
+		cr.SetChannelCapacity(capacity, strict)
+		return cr, logs
+	}
+
+	t.Run("lenient", func(t *testing.T) {
+		cr, logs := newReader(t, size-1, false)
+		require.NoError(t, cr.WriteChannel(data))
+		require.NotNil(t, logs.FindLog(testlog.NewMessageFilter("Channel data exceeds capacity")))
+		_, err := cr.NextBatch(context.Background())
+		require.NoError(t, err)
+	})
+
+	t.Run("strict", func(t *testing.T) {
+		cr, _ := newReader(t, size-1, true)
+		require.ErrorIs(t, cr.WriteChannel(data), ErrChannelTooLarge)
+	})
+
+	t.Run("within capacity", func(t *testing.T) {
+		cr, logs := newReader(t, size, true)
+		require.NoError(t, cr.WriteChannel(data))
+		require.Nil(t, logs.FindLog(testlog.NewMessageFilter("Channel data exceeds capacity")))
+	})
+}
+
+func TestChannelInReaderCountRemainingBatchesQuiet(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x133))
+	batch := NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	hints := 0
+	cr := newTestChannelInReader(t, WithL2BlockHints(func([]byte) { hints++ }))
+
+	require.NoError(t, cr.WriteChannel(compressRLP(t, []uint64{1}, batch, []uint64{2})))
+	count, err := cr.CountRemainingBatches()
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	require.Zero(t, hints, "counting must not surface hints")
+
+	_, err = cr.NextBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, hints)
+}
+
+func TestChannelInReaderFirstBatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x141))
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+	}
+	data := compressBatches(t, batches...)
+
+	cr := newTestChannelInReader(t)
+	_, err := cr.FirstBatch()
+	require.ErrorIs(t, err, io.EOF, "no current channel")
+
+	// Drain the channel once, to compare against.
+	require.NoError(t, cr.WriteChannel(data))
+	var drained []*BatchData
+	for {
+		batchData, err := cr.reader.readBatch()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		drained = append(drained, batchData)
+	}
+	require.Len(t, drained, len(batches))
+
+	require.NoError(t, cr.WriteChannel(data))
+	first, err := cr.FirstBatch()
+	require.NoError(t, err)
+	require.Equal(t, drained[0], first)
+
+	// The read position is unchanged.
+	batch, err := cr.NextBatch(context.Background())
+	require.NoError(t, err)
+	singular, ok := batch.AsSingularBatch()
+	require.True(t, ok)
+	require.Equal(t, batches[0].inner, singular)
+
+	first, err = cr.FirstBatch()
+	require.NoError(t, err)
+	require.Equal(t, drained[0], first)
+}
+
+func TestChannelInReaderWriteChannelChunk(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x145))
+	batches := make([]*BatchData, 3)
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	}
+	data := compressBatches(t, batches...)
+	total := uint64(len(data))
+
+	t.Run("chunks", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		third := len(data) / 3
+		ready, err := cr.WriteChannelChunk(data[:third], total)
+		require.NoError(t, err)
+		require.False(t, ready)
+		ready, err = cr.WriteChannelChunk(data[third:2*third], total)
+		require.NoError(t, err)
+		require.False(t, ready)
+		count, err := cr.CountRemainingBatches()
+		require.NoError(t, err)
+		require.Zero(t, count, "channel not written yet")
+
+		ready, err = cr.WriteChannelChunk(data[2*third:], total)
+		require.NoError(t, err)
+		require.True(t, ready)
+		count, err = cr.CountRemainingBatches()
+		require.NoError(t, err)
+		require.Equal(t, len(batches), count)
+
+		for _, expected := range batches {
+			batch, err := cr.NextBatch(context.Background())
+			require.NoError(t, err)
+			singular, ok := batch.AsSingularBatch()
+			require.True(t, ok)
+			require.Equal(t, expected.inner, singular)
+		}
+	})
+
+	t.Run("total-mismatch", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		_, err := cr.WriteChannelChunk(data[:10], total)
+		require.NoError(t, err)
+		_, err = cr.WriteChannelChunk(data[10:], total+1)
+		require.ErrorIs(t, err, ErrChannelLengthMismatch)
+
+		// The buffered chunks were dropped, a new channel can be written.
+		ready, err := cr.WriteChannelChunk(data, total)
+		require.NoError(t, err)
+		require.True(t, ready)
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		_, err := cr.WriteChannelChunk(data[:10], total-5)
+		require.NoError(t, err)
+		_, err = cr.WriteChannelChunk(data[10:], total-5)
+		require.ErrorIs(t, err, ErrChannelLengthMismatch)
+		count, err := cr.CountRemainingBatches()
+		require.NoError(t, err)
+		require.Zero(t, count)
+	})
+
+	t.Run("invalid-channel", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		invalid := []byte{0xaa, 0x01, 0x02, 0x03}
+		ready, err := cr.WriteChannelChunk(invalid[:2], uint64(len(invalid)))
+		require.NoError(t, err)
+		require.False(t, ready)
+		ready, err = cr.WriteChannelChunk(invalid[2:], uint64(len(invalid)))
+		require.Error(t, err)
+		require.False(t, ready, "rejected channel is not ready")
+		require.Nil(t, cr.reader)
+
+		// The chunks of the rejected channel were dropped.
+		ready, err = cr.WriteChannelChunk(data, total)
+		require.NoError(t, err)
+		require.True(t, ready)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		_, err := cr.WriteChannelChunk(data[:10], total)
+		require.NoError(t, err)
+		require.ErrorIs(t, cr.Reset(context.Background(), eth.L1BlockRef{}, eth.SystemConfig{}), io.EOF)
+		// The buffered chunks were dropped, so the full channel fits the total again.
+		ready, err := cr.WriteChannelChunk(data, total)
+		require.NoError(t, err)
+		require.True(t, ready)
+	})
+}
+
+func TestChannelInReaderCompressionRatio(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x152))
+	batches := make([]*BatchData, 3)
+	var decompressed int
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+		encoded, err := rlp.EncodeToBytes(batches[i])
+		require.NoError(t, err)
+		decompressed += len(encoded)
+	}
+	data := compressBatches(t, batches...)
+
+	var ratios []float64
+	m := &testutils.TestDerivationMetrics{
+		FnRecordChannelCompressionRatio: func(ratio float64) {
+			ratios = append(ratios, ratio)
+		},
+	}
+	cfg := &rollup.Config{ChannelTimeout: 10}
+	lgr := testlog.Logger(t, log.LevelCrit)
+	bank := NewChannelBank(lgr, cfg, &eofFrameProvider{}, nil, m)
+	cr := NewChannelInReader(cfg, lgr, bank, m)
+
+	ctx := context.Background()
+	require.NoError(t, cr.WriteChannel(data))
+	for range batches {
+		_, err := cr.NextBatch(ctx)
+		require.NoError(t, err)
+	}
+	require.Empty(t, ratios, "not reported before the channel is drained")
+	_, err := cr.NextBatch(ctx)
+	require.ErrorIs(t, err, NotEnoughData)
+	require.Equal(t, []float64{float64(decompressed) / float64(len(data))}, ratios)
+
+	// Channels dropped before they are drained are not reported.
+	require.NoError(t, cr.WriteChannel(data))
+	cr.NextChannel()
+	require.Len(t, ratios, 1)
+}
+
+func TestChannelInReaderCorruptChannelThenValid(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x154))
+	batches := make([]*BatchData, 3)
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	}
+	valid := compressBatches(t, batches...)
+	encoded := mustEncode(t, batches[1])
+
+	for _, tc := range []struct {
+		name    string
+		corrupt []byte
+	}{
+		{"invalid-batch", compressRLP(t, batches[0], []byte{0x7f, 0x01, 0x02})},
+		{"truncated-batch", compressRaw(t, append(mustEncode(t, batches[0]), encoded[:len(encoded)/2]...))},
+		{"truncated-stream", valid[:len(valid)/2]},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cr := newTestChannelInReader(t)
+			ctx := context.Background()
+
+			// The corrupt channel yields its valid first batch, then is dropped.
+			require.NoError(t, cr.WriteChannel(tc.corrupt))
+			for {
+				_, err := cr.NextBatch(ctx)
+				if err == NotEnoughData {
+					break
+				}
+				require.NoError(t, err)
+			}
+			require.Nil(t, cr.reader, "corrupt channel dropped")
+
+			// The valid channel is decoded from a fresh state.
+			require.NoError(t, cr.WriteChannel(valid))
+			for _, expected := range batches {
+				batch, err := cr.NextBatch(ctx)
+				require.NoError(t, err)
+				singular, ok := batch.AsSingularBatch()
+				require.True(t, ok)
+				require.Equal(t, expected.inner, singular)
+			}
+			_, err := cr.NextBatch(ctx)
+			require.ErrorIs(t, err, NotEnoughData)
+		})
+	}
+}
+
+func mustEncode(t *testing.T, val any) []byte {
+	data, err := rlp.EncodeToBytes(val)
+	require.NoError(t, err)
+	return data
+}
+
+func TestChannelInReaderChainIDGuard(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x156))
+	chainID := big.NewInt(333)
+	batch := NewBatchData(RandomSingularBatch(rng, 2, chainID))
+	ctx := context.Background()
+
+	t.Run("match", func(t *testing.T) {
+		cr := newTestChannelInReader(t, WithChainIDGuard(chainID))
+		require.NoError(t, cr.WriteChannel(compressRLP(t, chainID, batch)))
+		decoded, err := cr.NextBatch(ctx)
+		require.NoError(t, err)
+		singular, ok := decoded.AsSingularBatch()
+		require.True(t, ok)
+		require.Equal(t, batch.inner, singular)
+	})
+
+	t.Run("match-with-frame-count", func(t *testing.T) {
+		cr := newTestChannelInReader(t, WithChainIDGuard(chainID), WithFrameCountPrefix(2))
+		require.NoError(t, cr.WriteChannel(compressRLP(t, chainID, uint64(2), batch)))
+		_, err := cr.NextBatch(ctx)
+		require.NoError(t, err)
+	})
+
+	t.Run("mismatch", func(t *testing.T) {
+		cr := newTestChannelInReader(t, WithChainIDGuard(chainID))
+		err := cr.WriteChannel(compressRLP(t, big.NewInt(334), batch))
+		require.ErrorIs(t, err, ErrChainIDMismatch)
+		require.Nil(t, cr.reader)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		cr := newTestChannelInReader(t, WithChainIDGuard(chainID))
+		require.Error(t, cr.WriteChannel(compressBatches(t, batch)))
+		require.Nil(t, cr.reader)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		require.NoError(t, cr.WriteChannel(compressBatches(t, batch)))
+		_, err := cr.NextBatch(ctx)
+		require.NoError(t, err)
+	})
+}
+
+func TestChannelInReaderBatchLogging(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x157))
+	chainID := big.NewInt(333)
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, chainID)),
+		NewBatchData(RandomRawSpanBatch(rng, chainID)),
+	}
+	lgr, logs := testlog.CaptureLogger(t, log.LevelTrace)
+	cr := newTestChannelInReader(t, WithBatchLogging(lgr))
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batches...)))
+
+	// Re-decoding the channel doesn't log.
+	_, err := cr.CountRemainingBatches()
+	require.NoError(t, err)
+	require.Empty(t, logs.FindLogs(testlog.NewMessageFilter("Decoded batch")))
+
+	for range batches {
+		_, err := cr.reader.readBatch()
+		require.NoError(t, err)
+	}
+	records := logs.FindLogs(testlog.NewMessageFilter("Decoded batch"))
+	require.Len(t, records, len(batches))
+	for i, record := range records {
+		encoded, err := batches[i].MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, log.LevelTrace, record.Level)
+		require.Equal(t, int64(i), record.AttrValue("index"))
+		require.Equal(t, uint64(batches[i].GetBatchType()), record.AttrValue("type"))
+		require.Equal(t, int64(len(encoded)), record.AttrValue("size"))
+	}
+}
+
+func TestChannelInReaderValidate(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x160))
+	batches := make([]*BatchData, 3)
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	}
+	ctx := context.Background()
+
+	cr := newTestChannelInReader(t)
+	require.NoError(t, cr.Validate(), "no current channel")
+
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batches...)))
+	require.NoError(t, cr.Validate())
+	require.Nil(t, cr.reader, "channel dropped after validation")
+	_, err := cr.NextBatch(ctx)
+	require.ErrorIs(t, err, io.EOF)
+
+	// Validation continues from the current read position.
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batches...)))
+	_, err = cr.NextBatch(ctx)
+	require.NoError(t, err)
+	require.NoError(t, cr.Validate())
+
+	require.NoError(t, cr.WriteChannel(compressRLP(t, batches[0], []byte{0x7f, 0x01}, batches[1])))
+	require.Error(t, cr.Validate())
+	require.Nil(t, cr.reader)
+
+	valid := compressBatches(t, batches...)
+	require.NoError(t, cr.WriteChannel(valid[:len(valid)/2]))
+	require.ErrorIs(t, cr.Validate(), ErrTruncatedChannel)
+	require.Nil(t, cr.reader)
+}
+
+func TestChannelInReaderReadInto(t *testing.T) {
+	type record struct {
+		Number uint64
+		Name   string
+		Data   []byte
+	}
+	records := []record{
+		{Number: 1, Name: "first", Data: []byte{0x01, 0x02}},
+		{Number: 2, Name: "second", Data: []byte{0x03}},
+	}
+
+	cr := newTestChannelInReader(t)
+	var dest record
+	require.ErrorIs(t, cr.ReadInto(&dest), io.EOF, "no current channel")
+
+	require.NoError(t, cr.WriteChannel(compressRLP(t, records[0], records[1])))
+	for _, expected := range records {
+		var dest record
+		require.NoError(t, cr.ReadInto(&dest))
+		require.Equal(t, expected, dest)
+	}
+	require.ErrorIs(t, cr.ReadInto(&dest), io.EOF)
+
+	t.Run("length-prefixed", func(t *testing.T) {
+		cr := newTestChannelInReader(t, WithLengthPrefixedBatches())
+		require.NoError(t, cr.WriteChannel(compressRaw(t, lengthPrefixed(t, mustEncode(t, records[0]), mustEncode(t, records[1])))))
+		for _, expected := range records {
+			var dest record
+			require.NoError(t, cr.ReadInto(&dest))
+			require.Equal(t, expected, dest)
+		}
+		require.ErrorIs(t, cr.ReadInto(&dest), io.EOF)
+	})
+
+	t.Run("batch", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(0x169))
+		batch := NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+		cr := newTestChannelInReader(t)
+		require.NoError(t, cr.WriteChannel(compressBatches(t, batch)))
+		var raw []byte
+		require.NoError(t, cr.ReadInto(&raw))
+		expected, err := batch.MarshalBinary()
+		require.NoError(t, err)
+		require.Equal(t, expected, raw)
+	})
+
+	t.Run("mismatching-destination", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		require.NoError(t, cr.WriteChannel(compressRLP(t, records[0])))
+		var number uint64
+		require.Error(t, cr.ReadInto(&number))
+	})
+}
+
+func TestChannelInReaderWarningSink(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x183))
+	small := NewBatchData(RandomSingularBatch(rng, 1, big.NewInt(333)))
+	large := NewBatchData(RandomSingularBatch(rng, 20, big.NewInt(333)))
+	smallData, err := small.MarshalBinary()
+	require.NoError(t, err)
+	largeData, err := large.MarshalBinary()
+	require.NoError(t, err)
+	threshold := uint64(len(smallData))
+	require.Greater(t, uint64(len(largeData)), threshold)
+
+	var warnings []error
+	sink := func(warning error) {
+		warnings = append(warnings, warning)
+	}
+	cr := newTestChannelInReader(t, WithWarningSink(sink, threshold), WithEmptyBatchPolicy(EmptyBatchSkip))
+	require.NoError(t, cr.WriteChannel(compressRLP(t, small, []byte{}, large, small)))
+
+	// Re-decoding the channel doesn't emit warnings.
+	count, err := cr.CountRemainingBatches()
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+	require.Empty(t, warnings)
+
+	for i := 0; i < count; i++ {
+		_, err := cr.NextBatch(context.Background())
+		require.NoError(t, err)
+	}
+	require.Len(t, warnings, 2)
+	require.ErrorIs(t, warnings[0], ErrEmptyBatch)
+	require.ErrorIs(t, warnings[1], ErrLargeBatch)
+	require.ErrorContains(t, warnings[1], "batch 1")
+}
+
+func TestChannelInReaderDrain(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x193))
+	batches := make([]*BatchData, 4)
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	}
+
+	var drained []*BatchData
+	onBatch := func(batch *BatchData) {
+		drained = append(drained, batch)
+	}
+
+	cr := newTestChannelInReader(t)
+	require.NoError(t, cr.Drain(onBatch), "no current channel")
+	require.Empty(t, drained)
+
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batches...)))
+	_, err := cr.NextBatch(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, cr.Drain(onBatch))
+	require.Nil(t, cr.reader, "channel dropped after draining")
+	require.Len(t, drained, len(batches)-1, "draining continues from the current read position")
+	for i, batch := range drained {
+		require.Equal(t, batches[i+1].inner, batch.inner)
+	}
+
+	// Batches decoded before an error are passed to the callback.
+	drained = nil
+	require.NoError(t, cr.WriteChannel(compressRLP(t, batches[0], batches[1], []byte{0x7f})))
+	require.Error(t, cr.Drain(onBatch))
+	require.Len(t, drained, 2)
+	require.Equal(t, batches[0].inner, drained[0].inner)
+	require.Equal(t, batches[1].inner, drained[1].inner)
+}
+
+func TestChannelInReaderRewindBatch(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x197))
+	batches := make([]*BatchData, 3)
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	}
+
+	cr := newTestChannelInReader(t)
+	require.ErrorIs(t, cr.RewindBatch(), ErrNothingToRewind, "no current channel")
+
+	require.NoError(t, cr.WriteChannel(compressBatches(t, batches...)))
+	require.ErrorIs(t, cr.RewindBatch(), ErrNothingToRewind, "no batch read yet")
+
+	first, err := cr.reader.readBatch()
+	require.NoError(t, err)
+	require.NoError(t, cr.RewindBatch())
+	require.ErrorIs(t, cr.RewindBatch(), ErrNothingToRewind, "only a single batch can be rewound")
+	again, err := cr.reader.readBatch()
+	require.NoError(t, err)
+	require.Same(t, first, again)
+	require.Equal(t, batches[0].inner, again.inner)
+
+	// Reading continues after the rewound batch, and the batch can be rewound again.
+	second, err := cr.NextBatch(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, cr.RewindBatch())
+	secondAgain, err := cr.NextBatch(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, second, secondAgain)
+	require.Equal(t, batches[1].inner, secondAgain.(batchWithMetadata).Batch)
+
+	var drained []*BatchData
+	require.NoError(t, cr.Drain(func(batch *BatchData) {
+		drained = append(drained, batch)
+	}))
+	require.Len(t, drained, 1)
+	require.Equal(t, batches[2].inner, drained[0].inner)
+}
+
+func TestChannelInReaderRewindBatchPosition(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x197))
+	batches := make([]*BatchData, 3)
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	}
+	channel := compressBatches(t, batches...)
+
+	t.Run("count-remaining", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		require.NoError(t, cr.WriteChannel(channel))
+		_, err := cr.reader.readBatch()
+		require.NoError(t, err)
+		require.NoError(t, cr.RewindBatch())
+		count, err := cr.CountRemainingBatches()
+		require.NoError(t, err)
+		require.Equal(t, len(batches), count, "rewound batch counts as remaining")
+
+		_, err = cr.reader.readBatch()
+		require.NoError(t, err)
+		count, err = cr.CountRemainingBatches()
+		require.NoError(t, err)
+		require.Equal(t, len(batches)-1, count)
+	})
+
+	t.Run("read-into", func(t *testing.T) {
+		cr := newTestChannelInReader(t)
+		require.NoError(t, cr.WriteChannel(channel))
+		_, err := cr.reader.readBatch()
+		require.NoError(t, err)
+		require.NoError(t, cr.RewindBatch())
+
+		var dest BatchData
+		require.NoError(t, cr.ReadInto(&dest), "rewound batch is served")
+		require.Equal(t, batches[0].inner, dest.inner)
+		require.ErrorIs(t, cr.RewindBatch(), ErrNothingToRewind, "batches read with ReadInto can't be rewound")
+
+		// Reading continues after the rewound batch, and batches can be rewound again.
+		batch, err := cr.reader.readBatch()
+		require.NoError(t, err)
+		require.Equal(t, batches[1].inner, batch.inner)
+		require.NoError(t, cr.RewindBatch())
+		count, err := cr.CountRemainingBatches()
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		require.NoError(t, cr.ReadInto(&dest))
+		require.Equal(t, batches[1].inner, dest.inner)
+		require.NoError(t, cr.ReadInto(&dest))
+		require.Equal(t, batches[2].inner, dest.inner)
+		require.ErrorIs(t, cr.ReadInto(&dest), io.EOF)
+	})
+}
+
+func TestChannelInReaderSetBatchChecksums(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x105))
+	newChannel := func() ([]byte, []common.Hash) {
+		batches := make([]*BatchData, 2)
+		checksums := make([]common.Hash, len(batches))
+		for i := range batches {
+			batches[i] = NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+			data, err := batches[i].MarshalBinary()
+			require.NoError(t, err)
+			checksums[i] = crypto.Keccak256Hash(data)
+		}
+		return compressBatches(t, batches...), checksums
+	}
+	channelA, checksumsA := newChannel()
+	channelB, checksumsB := newChannel()
+
+	cr := newTestChannelInReader(t)
+	require.Error(t, cr.SetBatchChecksums(checksumsA), "no current channel")
+
+	// Each channel is validated against its own checksums.
+	require.NoError(t, cr.WriteChannel(channelA))
+	require.NoError(t, cr.SetBatchChecksums(checksumsA))
+	require.NoError(t, cr.Validate())
+	require.NoError(t, cr.WriteChannel(channelB))
+	require.NoError(t, cr.SetBatchChecksums(checksumsB))
+	require.NoError(t, cr.Validate())
+
+	// Checksums don't carry over to the next channel.
+	require.NoError(t, cr.WriteChannel(channelB))
+	require.NoError(t, cr.Validate())
+
+	require.NoError(t, cr.WriteChannel(channelB))
+	require.NoError(t, cr.SetBatchChecksums(checksumsA))
+	var checksumErr *BatchChecksumError
+	require.ErrorAs(t, cr.Validate(), &checksumErr)
+	require.Equal(t, 0, checksumErr.Index)
+}
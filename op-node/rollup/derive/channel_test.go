@@ -3,12 +3,21 @@ package derive
 import (
 	"bytes"
 	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
 	"math/big"
 	"math/rand"
+	"slices"
 	"testing"
 
 	"github.com/andybalholm/brotli"
 	"github.com/ethereum-optimism/optimism/op-service/eth"
+	"github.com/ethereum-optimism/optimism/op-service/testutils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rlp"
 	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 )
@@ -18,12 +27,14 @@ type frameValidityTC struct {
 	frames    []Frame
 	shouldErr []bool
 	sizes     []uint64
+	maxFrames uint64
 }
 
 func (tc *frameValidityTC) Run(t *testing.T) {
 	id := [16]byte{0xff}
 	block := eth.L1BlockRef{}
 	ch := NewChannel(id, block)
+	ch.SetMaxFrames(tc.maxFrames)
 
 	if len(tc.frames) != len(tc.shouldErr) || len(tc.frames) != len(tc.sizes) {
 		t.Errorf("lengths should be the same. frames: %d, shouldErr: %d, sizes: %d", len(tc.frames), len(tc.shouldErr), len(tc.sizes))
@@ -105,6 +116,26 @@ func TestFrameValidity(t *testing.T) {
 			shouldErr: []bool{false, false},
 			sizes:     []uint64{207, 411},
 		},
+		{
+			name: "frames within limit",
+			frames: []Frame{
+				{ID: id, FrameNumber: 0, Data: []byte("four")},
+				{ID: id, FrameNumber: 1, IsLast: true, Data: []byte("seven__")},
+			},
+			shouldErr: []bool{false, false},
+			sizes:     []uint64{204, 411},
+			maxFrames: 2,
+		},
+		{
+			name: "frame limit exceeded",
+			frames: []Frame{
+				{ID: id, FrameNumber: 1, Data: []byte("four")},
+				{ID: id, FrameNumber: 2, Data: []byte("seven__")},
+			},
+			shouldErr: []bool{false, true},
+			sizes:     []uint64{204, 204},
+			maxFrames: 2,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -112,6 +143,80 @@ func TestFrameValidity(t *testing.T) {
 	}
 }
 
+func TestChannelMaxFrames(t *testing.T) {
+	id := ChannelID{0xff}
+	ch := NewChannel(id, eth.L1BlockRef{})
+	ch.SetMaxFrames(3)
+	for i := uint16(0); i < 3; i++ {
+		require.NoError(t, ch.AddFrame(Frame{ID: id, FrameNumber: i}, eth.L1BlockRef{}))
+	}
+	require.ErrorIs(t, ch.AddFrame(Frame{ID: id, FrameNumber: 3, IsLast: true}, eth.L1BlockRef{}), ErrTooManyFrames)
+	require.ErrorIs(t, ch.AddFrame(Frame{ID: id, FrameNumber: 1000}, eth.L1BlockRef{}), ErrTooManyFrames)
+	require.False(t, ch.IsReady())
+}
+
+// appendFrameCRC appends the CRC of the frame data, as expected by Channel.SetFrameCRCs.
+func appendFrameCRC(frame Frame) Frame {
+	frame.Data = binary.BigEndian.AppendUint32(slices.Clone(frame.Data), crc32.ChecksumIEEE(frame.Data))
+	return frame
+}
+
+func TestChannelFrameCRCs(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x199))
+	batch := NewBatchData(RandomSingularBatch(rng, 5, big.NewInt(333)))
+	data := compressBatches(t, batch)
+	id := ChannelID{0xcc}
+	frames := splitFrames(id, data, 3)
+
+	t.Run("intact", func(t *testing.T) {
+		ch := NewChannel(id, eth.L1BlockRef{})
+		ch.SetFrameCRCs(true)
+		for _, frame := range frames {
+			require.NoError(t, ch.AddFrame(appendFrameCRC(frame), eth.L1BlockRef{}))
+		}
+		require.True(t, ch.IsReady())
+		assembled, err := io.ReadAll(ch.Reader())
+		require.NoError(t, err)
+		require.Equal(t, data, assembled)
+
+		readBatch, err := BatchReader(ch.Reader(), 10_000_000, false)
+		require.NoError(t, err)
+		dec, err := readBatch()
+		require.NoError(t, err)
+		require.Equal(t, batch.inner, dec.inner)
+	})
+
+	t.Run("corrupt", func(t *testing.T) {
+		ch := NewChannel(id, eth.L1BlockRef{})
+		ch.SetFrameCRCs(true)
+		require.NoError(t, ch.AddFrame(appendFrameCRC(frames[0]), eth.L1BlockRef{}))
+		corrupt := appendFrameCRC(frames[1])
+		corrupt.Data[0] ^= 0x01
+		require.ErrorIs(t, ch.AddFrame(corrupt, eth.L1BlockRef{}), ErrFrameCRCMismatch)
+		badCRC := appendFrameCRC(frames[1])
+		badCRC.Data[len(badCRC.Data)-1] ^= 0x01
+		require.ErrorIs(t, ch.AddFrame(badCRC, eth.L1BlockRef{}), ErrFrameCRCMismatch)
+		require.ErrorIs(t, ch.AddFrame(Frame{ID: id, FrameNumber: 1, Data: []byte{0x01}}, eth.L1BlockRef{}), ErrFrameCRCMismatch)
+		require.ErrorIs(t, ch.AddFrame(frames[2], eth.L1BlockRef{}), ErrFrameCRCMismatch, "frame without crc")
+		require.False(t, ch.IsReady())
+
+		// The frames can still be added with valid CRCs.
+		require.NoError(t, ch.AddFrame(appendFrameCRC(frames[1]), eth.L1BlockRef{}))
+		require.NoError(t, ch.AddFrame(appendFrameCRC(frames[2]), eth.L1BlockRef{}))
+		require.True(t, ch.IsReady())
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ch := NewChannel(id, eth.L1BlockRef{})
+		for _, frame := range frames {
+			require.NoError(t, ch.AddFrame(frame, eth.L1BlockRef{}))
+		}
+		assembled, err := io.ReadAll(ch.Reader())
+		require.NoError(t, err)
+		require.Equal(t, data, assembled)
+	})
+}
+
 func TestBatchReader(t *testing.T) {
 	rng := rand.New(rand.NewSource(0x543331))
 	singularBatch := RandomSingularBatch(rng, 20, big.NewInt(333))
@@ -236,3 +341,767 @@ func TestBatchReader(t *testing.T) {
 		})
 	}
 }
+
+// compressBatches RLP-encodes the batches and zlib-compresses them into channel data.
+func compressBatches(t *testing.T, batches ...*BatchData) []byte {
+	data, err := ChannelData(Zlib, batches...)
+	require.NoError(t, err)
+	return data
+}
+
+// compressRLP RLP-encodes the items back to back and zlib-compresses them into channel data.
+func compressRLP(t *testing.T, items ...any) []byte {
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	for _, item := range items {
+		require.NoError(t, rlp.Encode(writer, item))
+	}
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestBatchReaderChecksums(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x5eed))
+	chainID := big.NewInt(333)
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 5, chainID)),
+		NewBatchData(RandomSingularBatch(rng, 5, chainID)),
+	}
+	channel := compressBatches(t, batches...)
+	checksums := make([]common.Hash, len(batches))
+	for i, batch := range batches {
+		data, err := batch.MarshalBinary()
+		require.NoError(t, err)
+		checksums[i] = crypto.Keccak256Hash(data)
+	}
+
+	t.Run("matching", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithBatchChecksums(checksums))
+		require.NoError(t, err)
+		for range batches {
+			_, err := reader()
+			require.NoError(t, err)
+		}
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("mismatching", func(t *testing.T) {
+		expected := []common.Hash{checksums[0], {0xbb}}
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithBatchChecksums(expected))
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+
+		_, err = reader()
+		var checksumErr *BatchChecksumError
+		require.ErrorAs(t, err, &checksumErr)
+		require.Equal(t, 1, checksumErr.Index)
+		require.Equal(t, expected[1], checksumErr.Expected)
+		require.Equal(t, checksums[1], checksumErr.Actual)
+	})
+}
+
+func TestBatchReaderUncompressed(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x7a3))
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 3, big.NewInt(333))),
+		NewBatchData(RandomSingularBatch(rng, 3, big.NewInt(333))),
+	}
+	channel := []byte{ChannelVersionUncompressed}
+	for _, batch := range batches {
+		data, err := rlp.EncodeToBytes(batch)
+		require.NoError(t, err)
+		channel = append(channel, data...)
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		_, err := BatchReader(bytes.NewReader(channel), 10_000_000, true)
+		require.Error(t, err)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, true, WithUncompressedChannels())
+		require.NoError(t, err)
+		for _, expected := range batches {
+			batchData, err := reader()
+			require.NoError(t, err)
+			require.Equal(t, expected, batchData)
+		}
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestBatchReaderFrameCountPrefix(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x112))
+	batch := NewBatchData(RandomSingularBatch(rng, 3, big.NewInt(333)))
+	prefixed := compressRLP(t, uint64(3), batch)
+
+	t.Run("without prefix", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(compressBatches(t, batch)), 10_000_000, false)
+		require.NoError(t, err)
+		batchData, err := reader()
+		require.NoError(t, err)
+		require.Equal(t, batch.GetBatchType(), batchData.GetBatchType())
+	})
+
+	t.Run("matching prefix", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(prefixed), 10_000_000, false, WithFrameCountPrefix(3))
+		require.NoError(t, err)
+		batchData, err := reader()
+		require.NoError(t, err)
+		require.Equal(t, batch.GetBatchType(), batchData.GetBatchType())
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("unvalidated prefix", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(prefixed), 10_000_000, false, WithFrameCountPrefix(0))
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+	})
+
+	t.Run("mismatching prefix", func(t *testing.T) {
+		_, err := BatchReader(bytes.NewReader(prefixed), 10_000_000, false, WithFrameCountPrefix(2))
+		require.ErrorIs(t, err, ErrFrameCountMismatch)
+	})
+}
+
+func TestBatchReaderPanicRecovery(t *testing.T) {
+	// A batch of a custom type, whose decoder panics.
+	const customBatchType = 0x7e
+	channel := compressRLP(t, []byte{customBatchType, 0x01})
+	reg := NewBatchTypeRegistry()
+	require.NoError(t, reg.Register(customBatchType, func(payload []byte) (CustomBatch, error) {
+		panic("malformed custom batch")
+	}))
+
+	t.Run("enabled by default", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, true, WithBatchTypeRegistry(reg))
+		require.NoError(t, err)
+		batchData, err := reader()
+		require.ErrorIs(t, err, ErrBatchDecodePanic)
+		require.ErrorContains(t, err, "malformed custom batch")
+		require.Nil(t, batchData)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, true, WithBatchTypeRegistry(reg), WithPanicRecovery(false))
+		require.NoError(t, err)
+		require.Panics(t, func() {
+			_, _ = reader()
+		})
+	})
+
+	t.Run("callback panics propagate", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(0x114))
+		channel := compressBatches(t, NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))))
+		sink := func(warning error) {
+			panic("warning sink")
+		}
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, true, WithWarningSink(sink, 1))
+		require.NoError(t, err)
+		require.PanicsWithValue(t, "warning sink", func() {
+			_, _ = reader()
+		})
+	})
+}
+
+func TestBatchReaderEmptyBatchPolicy(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x120))
+	first := NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	second := NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333)))
+	channel := compressRLP(t, first, []byte{}, second)
+
+	newReader := func(t *testing.T, policy EmptyBatchPolicy) func() (*BatchData, error) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithEmptyBatchPolicy(policy))
+		require.NoError(t, err)
+		batchData, err := reader()
+		require.NoError(t, err)
+		require.Equal(t, first.inner, batchData.inner)
+		return reader
+	}
+
+	t.Run("pass-through", func(t *testing.T) {
+		reader := newReader(t, EmptyBatchPassThrough)
+		_, err := reader()
+		require.ErrorContains(t, err, "batch too short")
+		require.NotErrorIs(t, err, ErrEmptyBatch)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		reader := newReader(t, EmptyBatchSkip)
+		batchData, err := reader()
+		require.NoError(t, err)
+		require.Equal(t, second.inner, batchData.inner)
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		reader := newReader(t, EmptyBatchError)
+		_, err := reader()
+		require.ErrorIs(t, err, ErrEmptyBatch)
+	})
+}
+
+func TestBatchReaderTruncatedChannel(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x125))
+	batch := NewBatchData(RandomSingularBatch(rng, 10, big.NewInt(333)))
+	channel := compressBatches(t, batch)
+
+	reader, err := BatchReader(bytes.NewReader(channel[:len(channel)/2]), 10_000_000, false)
+	require.NoError(t, err)
+	_, err = reader()
+	require.ErrorIs(t, err, ErrTruncatedChannel)
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// A fully read channel ends with a clean io.EOF.
+	reader, err = BatchReader(bytes.NewReader(channel), 10_000_000, false)
+	require.NoError(t, err)
+	_, err = reader()
+	require.NoError(t, err)
+	_, err = reader()
+	require.ErrorIs(t, err, io.EOF)
+	require.NotErrorIs(t, err, ErrTruncatedChannel)
+}
+
+func TestBatchReaderMaxBatchElements(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x127))
+	chainID := big.NewInt(333)
+	singular := NewBatchData(RandomSingularBatch(rng, 10, chainID))
+	rawSpan := RandomRawSpanBatch(rng, chainID)
+	span := NewBatchData(rawSpan)
+	spanElements := rawSpan.blockCount
+	for _, txCount := range rawSpan.blockTxCounts {
+		spanElements += txCount
+	}
+
+	tests := []struct {
+		name        string
+		batch       *BatchData
+		maxElements uint64
+		expectErr   bool
+	}{
+		{name: "singular-no-cap", batch: singular, maxElements: 0},
+		{name: "singular-at-cap", batch: singular, maxElements: 10},
+		{name: "singular-over-cap", batch: singular, maxElements: 9, expectErr: true},
+		{name: "span-no-cap", batch: span, maxElements: 0},
+		{name: "span-at-cap", batch: span, maxElements: spanElements},
+		{name: "span-over-cap", batch: span, maxElements: spanElements - 1, expectErr: true},
+	}
+	for _, tc := range tests {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			channel := compressBatches(t, tc.batch)
+			reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, true, WithMaxBatchElements(tc.maxElements))
+			require.NoError(t, err)
+			_, err = reader()
+			if tc.expectErr {
+				require.ErrorIs(t, err, ErrTooManyBatchElements)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestBatchReaderL2BlockHints(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x133))
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+	}
+	hints := [][]uint64{{100, 1}, {101, 2}}
+	channel := compressRLP(t, batches[0], hints[0], batches[1], hints[1])
+
+	t.Run("disabled", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false)
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+		_, err = reader()
+		require.Error(t, err, "hint is not a valid batch")
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithL2BlockHints(nil))
+		require.NoError(t, err)
+		for _, expected := range batches {
+			batchData, err := reader()
+			require.NoError(t, err)
+			require.Equal(t, expected.inner, batchData.inner)
+		}
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("surface", func(t *testing.T) {
+		var surfaced [][]byte
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithL2BlockHints(func(hint []byte) {
+			surfaced = append(surfaced, hint)
+		}))
+		require.NoError(t, err)
+		for _, expected := range batches {
+			batchData, err := reader()
+			require.NoError(t, err)
+			require.Equal(t, expected.inner, batchData.inner)
+		}
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+
+		require.Len(t, surfaced, len(hints))
+		for i, hint := range hints {
+			expected, err := rlp.EncodeToBytes(hint)
+			require.NoError(t, err)
+			require.Equal(t, expected, surfaced[i])
+		}
+	})
+}
+
+// lengthPrefixed frames each item with its length as a 4-byte big-endian integer.
+func lengthPrefixed(t *testing.T, items ...[]byte) []byte {
+	var buf bytes.Buffer
+	for _, item := range items {
+		require.NoError(t, binary.Write(&buf, binary.BigEndian, uint32(len(item))))
+		buf.Write(item)
+	}
+	return buf.Bytes()
+}
+
+// compressRaw zlib-compresses the raw data into channel data.
+func compressRaw(t *testing.T, data []byte) []byte {
+	var buf bytes.Buffer
+	writer := zlib.NewWriter(&buf)
+	_, err := writer.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+	return buf.Bytes()
+}
+
+func TestBatchReaderLengthPrefixedBatches(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x148))
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+	}
+	encoded := make([][]byte, len(batches))
+	for i, batch := range batches {
+		var err error
+		encoded[i], err = rlp.EncodeToBytes(batch)
+		require.NoError(t, err)
+	}
+	framed := lengthPrefixed(t, encoded...)
+
+	readAll := func(t *testing.T, reader func() (*BatchData, error)) {
+		for _, expected := range batches {
+			batchData, err := reader()
+			require.NoError(t, err)
+			require.Equal(t, expected.inner, batchData.inner)
+		}
+		_, err := reader()
+		require.ErrorIs(t, err, io.EOF)
+	}
+
+	t.Run("framed", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(compressRaw(t, framed)), 10_000_000, false, WithLengthPrefixedBatches())
+		require.NoError(t, err)
+		readAll(t, reader)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(compressRaw(t, framed)), 10_000_000, false)
+		require.NoError(t, err)
+		_, err = reader()
+		require.Error(t, err, "length prefix is not a valid batch")
+	})
+
+	t.Run("frame-count-prefix", func(t *testing.T) {
+		prefix, err := rlp.EncodeToBytes(uint64(3))
+		require.NoError(t, err)
+		channel := compressRaw(t, append(prefix, framed...))
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithLengthPrefixedBatches(), WithFrameCountPrefix(3))
+		require.NoError(t, err)
+		readAll(t, reader)
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		channel := compressRaw(t, framed[:len(framed)-1])
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithLengthPrefixedBatches())
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+		_, err = reader()
+		require.ErrorIs(t, err, ErrTruncatedChannel)
+	})
+
+	t.Run("limit", func(t *testing.T) {
+		limit := uint64(len(encoded[0]) + len(encoded[1]) - 1)
+		reader, err := BatchReader(bytes.NewReader(compressRaw(t, framed)), limit, false, WithLengthPrefixedBatches())
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+		_, err = reader()
+		require.ErrorIs(t, err, rlp.ErrValueTooLarge)
+	})
+
+	t.Run("trailing-data", func(t *testing.T) {
+		channel := compressRaw(t, lengthPrefixed(t, append(encoded[0], 0x80)))
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithLengthPrefixedBatches())
+		require.NoError(t, err)
+		_, err = reader()
+		require.ErrorIs(t, err, rlp.ErrMoreThanOneValue)
+	})
+}
+
+func TestBatchReaderChannelContainers(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x151))
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+	}
+	canonical := compressBatches(t, batches...)
+	encoded := make([][]byte, len(batches))
+	for i, batch := range batches {
+		var err error
+		encoded[i], err = rlp.EncodeToBytes(batch)
+		require.NoError(t, err)
+	}
+	framed := compressRaw(t, lengthPrefixed(t, encoded...))
+	container := func(version byte, data []byte) []byte {
+		return append(append([]byte(ChannelContainerMagic), version), data...)
+	}
+
+	for _, tc := range []struct {
+		name    string
+		channel []byte
+	}{
+		{"canonical", canonical},
+		{"rlp-container", container(ContainerVersionRLP, canonical)},
+		{"length-prefixed-container", container(ContainerVersionLengthPrefixed, framed)},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			reader, err := BatchReader(bytes.NewReader(tc.channel), 10_000_000, false, WithChannelContainers())
+			require.NoError(t, err)
+			for _, expected := range batches {
+				batchData, err := reader()
+				require.NoError(t, err)
+				require.Equal(t, expected.inner, batchData.inner)
+			}
+			_, err = reader()
+			require.ErrorIs(t, err, io.EOF)
+		})
+	}
+
+	t.Run("unknown-version", func(t *testing.T) {
+		_, err := BatchReader(bytes.NewReader(container(0x7f, canonical)), 10_000_000, false, WithChannelContainers())
+		require.ErrorIs(t, err, ErrUnknownContainerVersion)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		_, err := BatchReader(bytes.NewReader(container(ContainerVersionRLP, canonical)), 10_000_000, false)
+		require.ErrorContains(t, err, "cannot distinguish the compression algo")
+	})
+}
+
+func TestBatchReaderChannelFooter(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x166))
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+	}
+	footer := func(count uint64) []byte {
+		return append([]byte{ChannelFooterType}, mustEncode(t, count)...)
+	}
+	readBatches := func(t *testing.T, channel []byte) (int, error) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithChannelFooter())
+		require.NoError(t, err)
+		for i := 0; ; i++ {
+			batchData, err := reader()
+			if err != nil {
+				return i, err
+			}
+			require.Equal(t, batches[i].inner, batchData.inner)
+		}
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		channel := compressRLP(t, batches[0], batches[1], footer(2))
+		count, err := readBatches(t, channel)
+		require.ErrorIs(t, err, io.EOF)
+		require.Equal(t, len(batches), count)
+	})
+
+	t.Run("wrong-count", func(t *testing.T) {
+		count, err := readBatches(t, compressRLP(t, batches[0], batches[1], footer(3)))
+		require.ErrorIs(t, err, ErrChannelFooterMismatch)
+		require.Equal(t, len(batches), count)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		_, err := readBatches(t, compressBatches(t, batches...))
+		require.ErrorIs(t, err, ErrChannelFooterMismatch)
+	})
+
+	t.Run("data-after-footer", func(t *testing.T) {
+		_, err := readBatches(t, compressRLP(t, batches[0], footer(1), batches[1]))
+		require.ErrorIs(t, err, ErrChannelFooterMismatch)
+	})
+
+	t.Run("length-prefixed", func(t *testing.T) {
+		channel := compressRaw(t, lengthPrefixed(t, mustEncode(t, batches[0]), mustEncode(t, footer(1))))
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithChannelFooter(), WithLengthPrefixedBatches())
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF, "stays at the end of the channel")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(compressRLP(t, batches[0], footer(1))), 10_000_000, false)
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+		_, err = reader()
+		require.ErrorContains(t, err, "unrecognized batch type")
+	})
+}
+
+func TestBatchReaderMonotonicTimestamps(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x186))
+	chainID := big.NewInt(333)
+	singular := func(timestamp uint64) *BatchData {
+		batch := RandomSingularBatch(rng, 1, chainID)
+		batch.Timestamp = timestamp
+		return NewBatchData(batch)
+	}
+	span := func(relTimestamp uint64) *BatchData {
+		batch := RandomRawSpanBatch(rng, chainID)
+		batch.relTimestamp = relTimestamp
+		return NewBatchData(batch)
+	}
+	readAll := func(t *testing.T, channel []byte, opts ...BatchReaderOption) (int, error) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, true, opts...)
+		require.NoError(t, err)
+		for i := 0; ; i++ {
+			if _, err := reader(); err == io.EOF {
+				return i, nil
+			} else if err != nil {
+				return i, err
+			}
+		}
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		channel := compressBatches(t, singular(10), singular(12), singular(12), span(5), singular(14))
+		count, err := readAll(t, channel, WithMonotonicTimestamps(SingularBatchType, SpanBatchType))
+		require.NoError(t, err)
+		require.Equal(t, 5, count)
+	})
+
+	t.Run("singular-out-of-order", func(t *testing.T) {
+		channel := compressBatches(t, singular(10), singular(14), singular(12))
+		count, err := readAll(t, channel, WithMonotonicTimestamps(SingularBatchType))
+		require.ErrorIs(t, err, ErrBatchOrder)
+		require.Equal(t, 2, count)
+
+		count, err = readAll(t, channel, WithMonotonicTimestamps(SpanBatchType))
+		require.NoError(t, err, "not checked for singular batches")
+		require.Equal(t, 3, count)
+
+		count, err = readAll(t, channel)
+		require.NoError(t, err, "disabled by default")
+		require.Equal(t, 3, count)
+	})
+
+	t.Run("span-out-of-order", func(t *testing.T) {
+		channel := compressBatches(t, span(20), span(10))
+		count, err := readAll(t, channel, WithMonotonicTimestamps(SpanBatchType))
+		require.ErrorIs(t, err, ErrBatchOrder)
+		require.Equal(t, 1, count)
+	})
+}
+
+func TestBatchReaderChannelAttestation(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x189))
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+	}
+	signature := testutils.RandomData(rng, 65)
+	attestation := append([]byte{ChannelAttestationType}, signature...)
+
+	t.Run("valid", func(t *testing.T) {
+		var attested [][]byte
+		channel := compressRLP(t, batches[0], batches[1], attestation)
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithChannelAttestation(func(attestation []byte) {
+			attested = append(attested, attestation)
+		}))
+		require.NoError(t, err)
+		for _, expected := range batches {
+			batchData, err := reader()
+			require.NoError(t, err)
+			require.Equal(t, expected.inner, batchData.inner)
+		}
+		require.Empty(t, attested)
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+		require.Equal(t, [][]byte{signature}, attested)
+		_, err = reader()
+		require.ErrorIs(t, err, io.EOF)
+		require.Len(t, attested, 1)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		reader, err := BatchReader(bytes.NewReader(compressBatches(t, batches...)), 10_000_000, false, WithChannelAttestation(nil))
+		require.NoError(t, err)
+		for range batches {
+			_, err := reader()
+			require.NoError(t, err)
+		}
+		_, err = reader()
+		require.ErrorIs(t, err, ErrChannelAttestation)
+	})
+
+	t.Run("not-last", func(t *testing.T) {
+		channel := compressRLP(t, batches[0], attestation, batches[1])
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithChannelAttestation(nil))
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+		_, err = reader()
+		require.ErrorIs(t, err, ErrChannelAttestation)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		channel := compressRLP(t, batches[0], attestation)
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false)
+		require.NoError(t, err)
+		_, err = reader()
+		require.NoError(t, err)
+		_, err = reader()
+		require.ErrorContains(t, err, "unrecognized batch type")
+	})
+
+	t.Run("with-footer", func(t *testing.T) {
+		channel := compressRLP(t, batches[0], attestation)
+		_, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithChannelAttestation(nil), WithChannelFooter())
+		require.ErrorIs(t, err, ErrChannelAttestation)
+	})
+}
+
+func TestBatchReaderBufferSizeFromHint(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		opts     []BatchReaderOption
+		sizeHint uint64
+		expected int
+	}{
+		{name: "default", expected: 0},
+		{name: "explicit", opts: []BatchReaderOption{WithReadBufferSize(1000)}, expected: 1000},
+		{name: "small-hint", opts: []BatchReaderOption{WithUncompressedSizeHint()}, sizeHint: 500, expected: 500},
+		{name: "large-hint", opts: []BatchReaderOption{WithUncompressedSizeHint()}, sizeHint: 1 << 30, expected: maxHintedReadBufferSize},
+		{name: "zero-hint", opts: []BatchReaderOption{WithUncompressedSizeHint()}, expected: 0},
+		{name: "explicit-and-hint", opts: []BatchReaderOption{WithUncompressedSizeHint(), WithReadBufferSize(1000)}, sizeHint: 500, expected: 1000},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := newBatchReaderConfig(tc.opts)
+			require.Equal(t, tc.expected, cfg.bufferSize(tc.sizeHint))
+		})
+	}
+}
+
+func TestBatchReaderUncompressedSizeHint(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x191))
+	batches := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+		NewBatchData(RandomSingularBatch(rng, 2, big.NewInt(333))),
+	}
+	var size uint64
+	for _, batch := range batches {
+		size += uint64(len(mustEncode(t, batch)))
+	}
+	compressed := compressBatches(t, batches...)
+	withHint := func(hint uint64) []byte {
+		return append(binary.AppendUvarint(nil, hint), compressed...)
+	}
+	readAll := func(t *testing.T, channel []byte) (int, error) {
+		reader, err := BatchReader(bytes.NewReader(channel), 10_000_000, false, WithUncompressedSizeHint())
+		require.NoError(t, err)
+		for i := 0; ; i++ {
+			if _, err := reader(); err == io.EOF {
+				return i, nil
+			} else if err != nil {
+				return i, err
+			}
+		}
+	}
+
+	t.Run("accurate", func(t *testing.T) {
+		count, err := readAll(t, withHint(size))
+		require.NoError(t, err)
+		require.Equal(t, len(batches), count)
+	})
+
+	t.Run("larger", func(t *testing.T) {
+		count, err := readAll(t, withHint(2*size))
+		require.NoError(t, err)
+		require.Equal(t, len(batches), count)
+	})
+
+	t.Run("exceeded", func(t *testing.T) {
+		count, err := readAll(t, withHint(size-1))
+		require.ErrorIs(t, err, ErrUncompressedSizeExceeded)
+		require.Equal(t, 1, count)
+		count, err = readAll(t, withHint(uint64(len(mustEncode(t, batches[0])))))
+		require.ErrorIs(t, err, ErrUncompressedSizeExceeded)
+		require.Equal(t, 1, count)
+	})
+
+	t.Run("missing", func(t *testing.T) {
+		// Without a hint, the zlib header is read as a varint.
+		_, err := BatchReader(bytes.NewReader(compressed), 10_000_000, false, WithUncompressedSizeHint())
+		require.Error(t, err)
+	})
+}
+
+func TestBatchReaderReadBufferSize(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x201))
+	batches := make([]*BatchData, 5)
+	encoded := make([][]byte, len(batches))
+	for i := range batches {
+		batches[i] = NewBatchData(RandomSingularBatch(rng, 10, big.NewInt(333)))
+		var err error
+		encoded[i], err = rlp.EncodeToBytes(batches[i])
+		require.NoError(t, err)
+	}
+	channels := map[string]struct {
+		data []byte
+		opts []BatchReaderOption
+	}{
+		"rlp":    {data: compressBatches(t, batches...)},
+		"framed": {data: compressRaw(t, lengthPrefixed(t, encoded...)), opts: []BatchReaderOption{WithLengthPrefixedBatches()}},
+	}
+
+	for name, channel := range channels {
+		for _, size := range []int{0, 16, 100, 4096, 1 << 20} {
+			t.Run(fmt.Sprintf("%s-%d", name, size), func(t *testing.T) {
+				opts := append([]BatchReaderOption{WithReadBufferSize(size)}, channel.opts...)
+				reader, err := BatchReader(bytes.NewReader(channel.data), 10_000_000, false, opts...)
+				require.NoError(t, err)
+				for _, expected := range batches {
+					batchData, err := reader()
+					require.NoError(t, err)
+					require.Equal(t, expected.inner, batchData.inner)
+				}
+				_, err = reader()
+				require.ErrorIs(t, err, io.EOF)
+			})
+		}
+	}
+}
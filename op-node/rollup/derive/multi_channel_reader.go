@@ -0,0 +1,97 @@
+package derive
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ethereum-optimism/optimism/op-service/eth"
+)
+
+// ChannelBatch is a batch read by a MultiChannelReader, tagged with the channel it was read from.
+type ChannelBatch struct {
+	ChannelID ChannelID
+	Batch     *BatchData
+}
+
+// MultiChannelReader reads the batches of multiple channels, which are stored back to back in
+// the frames of a single L1 transaction or blob. This is meant for tools replaying L1 data.
+// Channel boundaries are detected by changes of the channel id, and by closing frames.
+// Every channel must be complete within the data.
+type MultiChannelReader struct {
+	frames                []Frame
+	maxRLPBytesPerChannel uint64
+	isFjord               bool
+	opts                  []BatchReaderOption
+
+	// channelID is the id of the current channel, read by readBatch.
+	channelID ChannelID
+	readBatch func() (*BatchData, error)
+}
+
+// NewMultiChannelReader creates a MultiChannelReader over the frames of data, which is
+// serialized like the data of a batcher transaction, see ParseFrames.
+// The BatchReaderOptions are applied to the batch reader of every channel.
+func NewMultiChannelReader(data []byte, maxRLPBytesPerChannel uint64, isFjord bool, opts ...BatchReaderOption) (*MultiChannelReader, error) {
+	frames, err := ParseFrames(data)
+	if err != nil {
+		return nil, err
+	}
+	return &MultiChannelReader{
+		frames:                frames,
+		maxRLPBytesPerChannel: maxRLPBytesPerChannel,
+		isFjord:               isFjord,
+		opts:                  opts,
+	}, nil
+}
+
+// Next returns the next batch, tagged with the id of its channel.
+// It returns io.EOF after the last batch of the last channel.
+func (r *MultiChannelReader) Next() (ChannelBatch, error) {
+	for {
+		if r.readBatch != nil {
+			batch, err := r.readBatch()
+			if err == io.EOF {
+				r.readBatch = nil
+				continue
+			} else if err != nil {
+				return ChannelBatch{}, fmt.Errorf("failed to read batch from channel %s: %w", r.channelID, err)
+			}
+			return ChannelBatch{ChannelID: r.channelID, Batch: batch}, nil
+		}
+		if len(r.frames) == 0 {
+			return ChannelBatch{}, io.EOF
+		}
+		if err := r.nextChannel(); err != nil {
+			return ChannelBatch{}, err
+		}
+	}
+}
+
+// nextChannel assembles the next channel from the leading frames with the same channel id,
+// up to its closing frame, and sets up the batch reader of the channel.
+func (r *MultiChannelReader) nextChannel() error {
+	id := r.frames[0].ID
+	ch := NewChannel(id, eth.L1BlockRef{})
+	n := 0
+	for n < len(r.frames) && r.frames[n].ID == id {
+		frame := r.frames[n]
+		n++
+		if err := ch.AddFrame(frame, eth.L1BlockRef{}); err != nil {
+			return fmt.Errorf("failed to add frame %d to channel %s: %w", frame.FrameNumber, id, err)
+		}
+		if frame.IsLast {
+			break
+		}
+	}
+	r.frames = r.frames[n:]
+	if !ch.IsReady() {
+		return fmt.Errorf("channel %s is incomplete", id)
+	}
+	readBatch, err := BatchReader(ch.Reader(), r.maxRLPBytesPerChannel, r.isFjord, r.opts...)
+	if err != nil {
+		return fmt.Errorf("failed to create batch reader for channel %s: %w", id, err)
+	}
+	r.channelID = id
+	r.readBatch = readBatch
+	return nil
+}
@@ -0,0 +1,102 @@
+package derive
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// serializeFrames serializes the frames like the data of a batcher transaction.
+func serializeFrames(t *testing.T, frames ...Frame) []byte {
+	var buf bytes.Buffer
+	buf.WriteByte(DerivationVersion0)
+	for _, frame := range frames {
+		require.NoError(t, frame.MarshalBinary(&buf))
+	}
+	return buf.Bytes()
+}
+
+// splitFrames splits the channel data into numFrames frames of the channel.
+func splitFrames(id ChannelID, data []byte, numFrames int) []Frame {
+	frames := make([]Frame, 0, numFrames)
+	size := (len(data) + numFrames - 1) / numFrames
+	for i := 0; i < numFrames; i++ {
+		end := min((i+1)*size, len(data))
+		frames = append(frames, Frame{
+			ID:          id,
+			FrameNumber: uint16(i),
+			Data:        data[i*size : end],
+			IsLast:      i == numFrames-1,
+		})
+	}
+	return frames
+}
+
+func TestMultiChannelReader(t *testing.T) {
+	rng := rand.New(rand.NewSource(0x179))
+	chainID := big.NewInt(333)
+	batchesA := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, chainID)),
+		NewBatchData(RandomSingularBatch(rng, 2, chainID)),
+	}
+	batchesB := []*BatchData{
+		NewBatchData(RandomSingularBatch(rng, 2, chainID)),
+	}
+	idA, idB := ChannelID{0xaa}, ChannelID{0xbb}
+	framesA := splitFrames(idA, compressBatches(t, batchesA...), 2)
+	framesB := splitFrames(idB, compressBatches(t, batchesB...), 1)
+
+	t.Run("two-channels", func(t *testing.T) {
+		data := serializeFrames(t, append(framesA, framesB...)...)
+		r, err := NewMultiChannelReader(data, 10_000_000, false)
+		require.NoError(t, err)
+
+		expected := []ChannelBatch{
+			{ChannelID: idA, Batch: batchesA[0]},
+			{ChannelID: idA, Batch: batchesA[1]},
+			{ChannelID: idB, Batch: batchesB[0]},
+		}
+		for _, exp := range expected {
+			batch, err := r.Next()
+			require.NoError(t, err)
+			require.Equal(t, exp.ChannelID, batch.ChannelID)
+			require.Equal(t, exp.Batch.inner, batch.Batch.inner)
+		}
+		_, err = r.Next()
+		require.ErrorIs(t, err, io.EOF)
+	})
+
+	t.Run("same-id-after-closing-frame", func(t *testing.T) {
+		framesA2 := splitFrames(idA, compressBatches(t, batchesB...), 1)
+		data := serializeFrames(t, append(framesA, framesA2...)...)
+		r, err := NewMultiChannelReader(data, 10_000_000, false)
+		require.NoError(t, err)
+		var count int
+		for {
+			_, err := r.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			count++
+		}
+		require.Equal(t, len(batchesA)+len(batchesB), count)
+	})
+
+	t.Run("incomplete-channel", func(t *testing.T) {
+		data := serializeFrames(t, framesA[0], framesB[0])
+		r, err := NewMultiChannelReader(data, 10_000_000, false)
+		require.NoError(t, err)
+		_, err = r.Next()
+		require.ErrorContains(t, err, "incomplete")
+	})
+
+	t.Run("invalid-data", func(t *testing.T) {
+		_, err := NewMultiChannelReader([]byte{0x01}, 10_000_000, false)
+		require.Error(t, err)
+	})
+}
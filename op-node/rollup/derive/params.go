@@ -28,6 +28,12 @@ const DerivationVersion1 = plasma.TxDataVersion1
 // or transaction per block allowed in a span batch.
 const MaxSpanBatchElementCount = 10_000_000
 
+// ErrTooManyFrames is returned when a frame exceeds the frame limit of a channel, see Channel.SetMaxFrames.
+var ErrTooManyFrames = errors.New("too many frames in channel")
+
+// ErrFrameCRCMismatch is returned when the CRC of a frame doesn't match its data, see Channel.SetFrameCRCs.
+var ErrFrameCRCMismatch = errors.New("frame crc mismatch")
+
 // DuplicateErr is returned when a newly read frame is already known
 var DuplicateErr = errors.New("duplicate frame")
 
@@ -39,6 +39,7 @@ type Metrics interface {
 	RecordL1Ref(name string, ref eth.L1BlockRef)
 	RecordL2Ref(name string, ref eth.L2BlockRef)
 	RecordChannelInputBytes(inputCompressedBytes int)
+	RecordChannelCompressionRatio(ratio float64)
 	RecordHeadChannelOpened()
 	RecordChannelTimedOut()
 	RecordFrame()
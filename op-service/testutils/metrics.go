@@ -9,11 +9,12 @@ import (
 // TestDerivationMetrics implements the metrics used in the derivation pipeline as no-op operations.
 // Optionally a test may hook into the metrics
 type TestDerivationMetrics struct {
-	FnRecordL1ReorgDepth      func(d uint64)
-	FnRecordL1Ref             func(name string, ref eth.L1BlockRef)
-	FnRecordL2Ref             func(name string, ref eth.L2BlockRef)
-	FnRecordUnsafePayloads    func(length uint64, memSize uint64, next eth.BlockID)
-	FnRecordChannelInputBytes func(inputCompressedBytes int)
+	FnRecordL1ReorgDepth            func(d uint64)
+	FnRecordL1Ref                   func(name string, ref eth.L1BlockRef)
+	FnRecordL2Ref                   func(name string, ref eth.L2BlockRef)
+	FnRecordUnsafePayloads          func(length uint64, memSize uint64, next eth.BlockID)
+	FnRecordChannelInputBytes       func(inputCompressedBytes int)
+	FnRecordChannelCompressionRatio func(ratio float64)
 }
 
 func (t *TestDerivationMetrics) CountSequencedTxs(count int) {
@@ -55,6 +56,12 @@ func (t *TestDerivationMetrics) RecordChannelInputBytes(inputCompressedBytes int
 	}
 }
 
+func (t *TestDerivationMetrics) RecordChannelCompressionRatio(ratio float64) {
+	if t.FnRecordChannelCompressionRatio != nil {
+		t.FnRecordChannelCompressionRatio(ratio)
+	}
+}
+
 func (t *TestDerivationMetrics) RecordHeadChannelOpened() {
 }
 